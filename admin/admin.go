@@ -0,0 +1,292 @@
+// Package admin provides an http.Handler for looking at and changing
+// the logging configuration of a running process, meant to be
+// mounted on a debug port:
+//
+//	h := admin.New(pretty.Writer, ring)
+//	h.Authorize = checkAdminToken
+//	mux.Handle("/debug/logging/", http.StripPrefix("/debug/logging", h))
+//
+// The endpoints are:
+//
+//	GET    /modules              known modules, their effective levels and activity
+//	GET    /rules                the level rules, as [{"module":..,"level":..}]
+//	PUT    /rules                replace the level rules
+//	GET    /overrides            the temporary overrides in effect
+//	POST   /overrides            add one, as {"module":..,"level":..,"ttl":"15m"}
+//	DELETE /overrides?module=m   cancel one
+//	GET    /stream               live records as server-sent events
+//
+// The stream (which needs a Ring) can be narrowed down with the query
+// parameters level (the least severe level to send), module (a
+// pattern, as for LevelFilter.SetLevel) and annot (either key or
+// key=value, and may be repeated).
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dkolbly/logging"
+)
+
+// ErrNoAuthorizer is reported for requests that would change the
+// configuration when the handler has no Authorize hook
+var ErrNoAuthorizer = errors.New("no authorization configured")
+
+type Handler struct {
+	filter *logging.LevelFilter
+	ring   *logging.Ring
+	mux    *http.ServeMux
+
+	// Authorize is consulted for requests that would change the
+	// configuration, which are refused if it returns an error.  If
+	// it is nil, all such requests are refused.
+	Authorize func(*http.Request) error
+}
+
+// New creates a handler for the given filter; the ring, which may be
+// nil, is the source of live records for the stream endpoint
+func New(filter *logging.LevelFilter, ring *logging.Ring) *Handler {
+	h := &Handler{
+		filter: filter,
+		ring:   ring,
+		mux:    http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/modules", h.modules)
+	h.mux.HandleFunc("/rules", h.rules)
+	h.mux.HandleFunc("/overrides", h.overrides)
+	h.mux.HandleFunc("/stream", h.stream)
+	return h
+}
+
+// AllowAll is an Authorize hook that allows everything, for use when
+// the debug port is otherwise protected
+func AllowAll(*http.Request) error {
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	err := ErrNoAuthorizer
+	if h.Authorize != nil {
+		err = h.Authorize(r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func notAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+// ModuleLevel is an entry in the list of modules, which includes
+// both those that loggers were created for and those that the filter
+// has seen records from
+type ModuleLevel struct {
+	Module  string        `json:"module"`
+	Level   logging.Level `json:"level"`
+	Created []string      `json:"created,omitempty"`
+	Records uint64        `json:"records"`
+}
+
+func (h *Handler) modules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	known := make(map[string]bool)
+	lst := []ModuleLevel{}
+	for _, info := range logging.Modules() {
+		known[info.Module] = true
+		lst = append(lst, ModuleLevel{
+			Module:  info.Module,
+			Level:   h.filter.GetLevel(info.Module),
+			Created: info.Created,
+			Records: info.Records,
+		})
+	}
+	for _, module := range h.filter.Modules() {
+		if !known[module] {
+			lst = append(lst, ModuleLevel{
+				Module: module,
+				Level:  h.filter.GetLevel(module),
+			})
+		}
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].Module < lst[j].Module
+	})
+	reply(w, lst)
+}
+
+func (h *Handler) rules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		reply(w, h.filter.Rules())
+	case http.MethodPut:
+		if !h.authorized(w, r) {
+			return
+		}
+		var req []ruleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req == nil {
+			http.Error(w, "missing rules", http.StatusBadRequest)
+			return
+		}
+		lst := make([]logging.LevelSetting, len(req))
+		for i, rule := range req {
+			if rule.Module == "" || rule.Level == nil {
+				http.Error(w, fmt.Sprintf("rule %d needs a module and a level", i), http.StatusBadRequest)
+				return
+			}
+			lst[i] = logging.LevelSetting{Module: rule.Module, Level: *rule.Level}
+		}
+		h.filter.SetRules(lst)
+		reply(w, h.filter.Rules())
+	default:
+		notAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+// ruleRequest is an entry in the body of a request to replace the
+// rules; unlike a LevelSetting, it can tell a missing level from
+// EMERGENCY
+type ruleRequest struct {
+	Module string         `json:"module"`
+	Level  *logging.Level `json:"level"`
+}
+
+// OverrideRequest is the body of a request to add an override
+type OverrideRequest struct {
+	Module string         `json:"module"`
+	Level  *logging.Level `json:"level"`
+	TTL    string         `json:"ttl"`
+}
+
+func (h *Handler) overrides(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		reply(w, h.filter.Overrides())
+	case http.MethodPost:
+		if !h.authorized(w, r) {
+			return
+		}
+		var req OverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+			return
+		}
+		if req.Module == "" {
+			http.Error(w, "missing module", http.StatusBadRequest)
+			return
+		}
+		if req.Level == nil {
+			http.Error(w, "missing level", http.StatusBadRequest)
+			return
+		}
+		h.filter.Override(*req.Level, req.Module, ttl)
+		reply(w, h.filter.Overrides())
+	case http.MethodDelete:
+		if !h.authorized(w, r) {
+			return
+		}
+		if !h.filter.CancelOverride(r.URL.Query().Get("module")) {
+			http.Error(w, "no such override", http.StatusNotFound)
+			return
+		}
+		reply(w, h.filter.Overrides())
+	default:
+		notAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func parseQuery(r *http.Request) (logging.Query, error) {
+	var q logging.Query
+	params := r.URL.Query()
+	if s := params.Get("level"); s != "" {
+		level, err := logging.ParseLevel(s)
+		if err != nil {
+			return q, err
+		}
+		q.Levels = logging.AtLeast(level)
+	}
+	q.Module = params.Get("module")
+	for _, a := range params["annot"] {
+		m := logging.AnnotMatch{Key: a}
+		if eq := strings.IndexByte(a, '='); eq >= 0 {
+			m.Key = a[:eq]
+			m.Values = []string{a[eq+1:]}
+		}
+		q.Annots = append(q.Annots, m)
+	}
+	return q, nil
+}
+
+const streamBuffer = 256
+
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if h.ring == nil || !ok {
+		http.Error(w, "streaming not available", http.StatusNotImplemented)
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub := h.ring.Subscribe(q, streamBuffer)
+	defer sub.Cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case rec, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			buf, err := rec.JSON(1)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", rec.ID, buf)
+			flusher.Flush()
+		}
+	}
+}
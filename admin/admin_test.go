@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dkolbly/logging"
+)
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestRejectsIncompleteRequests(t *testing.T) {
+	f := logging.MustFilter(logging.NewRing(10))
+	f.SetLevel(logging.INFO, "*")
+	h := New(f, nil)
+	h.Authorize = AllowAll
+
+	bad := []struct{ method, path, body string }{
+		{"POST", "/overrides", `{"module":"db","ttl":"1m"}`},
+		{"POST", "/overrides", `{"module":"db","level":"LOUD","ttl":"1m"}`},
+		{"POST", "/overrides", `{"level":"debug","ttl":"1m"}`},
+		{"POST", "/overrides", `{"module":"db","level":"debug"}`},
+		{"PUT", "/rules", `null`},
+		{"PUT", "/rules", ``},
+		{"PUT", "/rules", `[{"module":"*"}]`},
+		{"PUT", "/rules", `[{"level":"debug"}]`},
+	}
+	for _, req := range bad {
+		if w := do(h, req.method, req.path, req.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected 400, got %d", req.method, req.path, req.body, w.Code)
+		}
+	}
+	if len(f.Overrides()) != 0 {
+		t.Fatalf("unexpected overrides %+v", f.Overrides())
+	}
+	if rules := f.Rules(); len(rules) != 1 || rules[0].Level != logging.INFO {
+		t.Fatalf("rules should be unchanged, got %+v", rules)
+	}
+
+	if w := do(h, "POST", "/overrides", `{"module":"db","level":"debug","ttl":"1m"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if f.GetLevel("db") != logging.DEBUG {
+		t.Fatalf("expected the override to take effect")
+	}
+	if w := do(h, "PUT", "/rules", `[]`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if len(f.Rules()) != 0 {
+		t.Fatalf("expected the rules to be cleared")
+	}
+}
+
+func TestRefusesWithoutAuthorizer(t *testing.T) {
+	f := logging.MustFilter(logging.NewRing(10))
+	h := New(f, nil)
+	if w := do(h, "PUT", "/rules", `[]`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
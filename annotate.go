@@ -20,6 +20,7 @@ func (l *Logger) Re(a Annotater) *Logger {
 		module:  l.module,
 		annot:   grow(l.annot),
 		outputs: l.outputs,
+		reg:     l.reg,
 	}
 	// now add whatever new annotations we have in mind
 	var tmp Record
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+type annotRule struct {
+	pattern string
+	annots  []AnnotMatch
+	level   Level
+}
+
+type annotRules struct {
+	count int32
+	lock  sync.Mutex
+	rules []annotRule
+}
+
+// SetAnnotLevel sets the level for records from the given module (a
+// pattern, as in SetLevel) that also carry matching annotations,
+// such as a particular customer's requests:
+//
+//	f.SetAnnotLevel(logging.DEBUG, "*", logging.AnnotMatch{Key: "user", Values: []string{"acme"}})
+//
+// For a record to which such a rule applies, its level replaces the
+// one for the module (including any override), whether that makes the
+// filter more or less permissive.  Where several apply, the most
+// specific by module wins, as in SetLevel.  Setting a rule with the
+// same module and annotations as an existing one replaces it.
+func (f *LevelFilter) SetAnnotLevel(level Level, module string, annots ...AnnotMatch) {
+	ar := &f.annots
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+	for i, rule := range ar.rules {
+		if rule.pattern == module && reflect.DeepEqual(rule.annots, annots) {
+			ar.rules[i].level = level
+			return
+		}
+	}
+	ar.rules = append(ar.rules, annotRule{module, annots, level})
+	atomic.StoreInt32(&ar.count, int32(len(ar.rules)))
+}
+
+// ClearAnnotLevels removes all the rules set by SetAnnotLevel
+func (f *LevelFilter) ClearAnnotLevels() {
+	ar := &f.annots
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+	ar.rules = nil
+	atomic.StoreInt32(&ar.count, 0)
+}
+
+// active is the cheap check for whether there are any rules at all
+func (ar *annotRules) active() bool {
+	return atomic.LoadInt32(&ar.count) > 0
+}
+
+// level returns the threshold for the record, given the one that
+// applies to its module
+func (ar *annotRules) level(rec *Record, level Level) Level {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+	best := -1
+	for _, rule := range ar.rules {
+		score, ok := specificity(rule.pattern, rec.Module)
+		if !ok || score <= best {
+			continue
+		}
+		if rule.match(rec) {
+			best = score
+			level = rule.level
+		}
+	}
+	return level
+}
+
+func (rule *annotRule) match(rec *Record) bool {
+	for i := range rule.annots {
+		if !rule.annots[i].Match(rec) {
+			return false
+		}
+	}
+	return true
+}
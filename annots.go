@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// annotsFormat is the compiled form of the options of %{annots}, a
+// comma-separated list of a style and the annotations to include or
+// leave out:
+//
+//	kv       key=value, separated by spaces (the default)
+//	colon    key:value, separated by spaces
+//	json     a JSON object
+//	+pat     only include annotations whose key matches pat (a glob)
+//	-pat     leave out annotations whose key matches pat
+//
+// Annotations printed elsewhere in the pattern, and the captured
+// "source", are always left out.
+type annotsFormat struct {
+	style   string
+	include []string
+	exclude []string
+	printed *printedAnnots
+}
+
+// printedAnnots keeps track of the annotations that a pattern prints
+// with their own verbs.  Those inside %{if} sections only count for
+// the records that take the branches they are in.
+type printedAnnots struct {
+	always    map[string]bool
+	sometimes map[string][][]guard // any one of the lists of guards
+}
+
+// a guard is the branch of an enclosing %{if} that a verb is in
+type guard struct {
+	cond condition
+	then bool
+}
+
+func newPrintedAnnots() *printedAnnots {
+	return &printedAnnots{
+		always:    make(map[string]bool),
+		sometimes: make(map[string][][]guard),
+	}
+}
+
+// add notes that the annotation is printed inside the open sections
+func (p *printedAnnots) add(key string, open []*section) {
+	if len(open) == 0 {
+		p.always[key] = true
+		return
+	}
+	guards := make([]guard, len(open))
+	for i, sect := range open {
+		guards[i] = guard{sect.cond, !sect.inElse}
+	}
+	p.sometimes[key] = append(p.sometimes[key], guards)
+}
+
+// printed tells whether the annotation is printed for the record
+func (p *printedAnnots) printed(key string, rec *Record) bool {
+	if p.always[key] {
+		return true
+	}
+next:
+	for _, guards := range p.sometimes[key] {
+		for _, g := range guards {
+			if g.cond(rec) != g.then {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func makeAnnotsFrag(options string, printed *printedAnnots) (fragmentFormatter, error) {
+	af := &annotsFormat{
+		style:   "kv",
+		exclude: []string{SourceKey},
+		printed: printed,
+	}
+	if options != "" {
+		for _, opt := range strings.Split(options, ",") {
+			if opt == "kv" || opt == "colon" || opt == "json" {
+				af.style = opt
+				continue
+			}
+			if len(opt) < 2 || (opt[0] != '+' && opt[0] != '-') {
+				return nil, fmt.Errorf("logger: invalid annots option %q", opt)
+			}
+			if _, err := path.Match(opt[1:], ""); err != nil {
+				return nil, fmt.Errorf("logger: invalid annots option %q", opt)
+			}
+			if opt[0] == '+' {
+				af.include = append(af.include, opt[1:])
+			} else {
+				af.exclude = append(af.exclude, opt[1:])
+			}
+		}
+	}
+	return af.format, nil
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if match, _ := path.Match(p, key); match {
+			return true
+		}
+	}
+	return false
+}
+
+func (af *annotsFormat) keys(rec *Record) []string {
+	var keys []string
+	for k := range rec.Annotations {
+		if af.printed.printed(k, rec) || matchAny(af.exclude, k) {
+			continue
+		}
+		if af.include != nil && !matchAny(af.include, k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	// maps have no order, so make one
+	sort.Strings(keys)
+	return keys
+}
+
+func (af *annotsFormat) format(ctx *OutputContext) {
+	keys := af.keys(ctx.src)
+	if af.style == "json" {
+		ctx.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				ctx.WriteString(",")
+			}
+			key, _ := json.Marshal(k)
+			ctx.Write(key)
+			ctx.WriteString(":")
+			v := ctx.src.Annotations[k]
+			buf, err := json.Marshal(v)
+			if err != nil {
+				buf, _ = json.Marshal(fmt.Sprint(v))
+			}
+			ctx.Write(buf)
+		}
+		ctx.WriteString("}")
+		return
+	}
+
+	sep := "="
+	if af.style == "colon" {
+		sep = ":"
+	}
+	for i, k := range keys {
+		if i > 0 {
+			ctx.WriteString(" ")
+		}
+		v := ctx.src.Annotations[k]
+		str, ok := v.(string)
+		if !ok {
+			str = fmt.Sprint(v)
+		}
+		ctx.WriteString(quoteIfNeeded(k))
+		ctx.WriteString(sep)
+		ctx.WriteString(quoteIfNeeded(str))
+	}
+}
+
+// quoteIfNeeded quotes a key or value if it would otherwise be
+// ambiguous in a list of key=value or key:value pairs
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, ch := range s {
+		if ch <= ' ' || ch == '=' || ch == ':' || ch == '"' || ch == '\\' || ch == 0x7f || !strconv.IsPrint(ch) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package logging
+
+import "testing"
+
+func TestAnnotsStyles(t *testing.T) {
+	rec := &Record{Annotations: map[string]interface{}{
+		"req": "7", "user": "acme corp", "zz": "a=b", "e": "",
+		SourceKey: &Source{Path: "x.go"},
+	}}
+	for pat, want := range map[string]string{
+		"%{annots}":               `e="" req=7 user="acme corp" zz="a=b"`,
+		"%{annots} %{annot/req}":  `e="" user="acme corp" zz="a=b" 7`,
+		"%{annots:colon,-u*}":     `e:"" req:7 zz:"a=b"`,
+		"%{annots:json}":          `{"e":"","req":"7","user":"acme corp","zz":"a=b"}`,
+		"%{annots:+req,+z*,json}": `{"req":"7","zz":"a=b"}`,
+	} {
+		if got := formatPlain(t, pat, rec); got != want {
+			t.Errorf("%s: expected %q, got %q", pat, want, got)
+		}
+	}
+	for _, pat := range []string{"%{annots:bogus}", "%{annots:+[}", "%{annots:+}"} {
+		if _, err := PatternFormatter(pat); err == nil {
+			t.Errorf("expected %q to be rejected", pat)
+		}
+	}
+}
+
+func TestAnnotsSkipsConditionallyPrinted(t *testing.T) {
+	rec := &Record{Level: INFO, Annotations: map[string]interface{}{
+		"req": "r 1", "b": "2",
+	}}
+	cases := []struct {
+		pat  string
+		want string
+	}{
+		// printed in the section, so not again
+		{"%{if annot/req}[%{annot/req}]%{end} %{annots}", `[r 1] b=2`},
+		// ...whichever comes first
+		{"%{annots} %{if annot/req}[%{annot/req}]%{end}", `b=2 [r 1]`},
+		// a section that isn't taken doesn't count
+		{"%{if level<=ERROR}%{annot/req} %{end}%{annots}", `b=2 req="r 1"`},
+		{"%{if level<=ERROR}-%{else}%{annot/req} %{end}%{annots}", `r 1 b=2`},
+		// nested sections all have to be taken
+		{"%{if annot/req}%{if annot/b}%{annot/b} %{end}%{end}%{annots}", `2 req="r 1"`},
+		{"%{if annot/req}%{if annot/nope}%{annot/b} %{end}%{end}%{annots}", `b=2 req="r 1"`},
+	}
+	for _, c := range cases {
+		if got := formatPlain(t, c.pat, rec); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.pat, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// splitFuncName splits a fully qualified function name, like
+// "github.com/dkolbly/logging.(*Logger).Info", into its package path
+// and the name within the package
+func splitFuncName(name string) (pkg, short string) {
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return "", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
+}
+
+func makeLongFileFrag(options string) (fragmentFormatter, error) {
+	if options == "" {
+		options = "%[1]s:%[2]d"
+	}
+	return func(ctx *OutputContext) {
+		file, line, ok := ctx.src.Caller(ctx.stackSkip)
+		if !ok {
+			file = "???"
+			line = 0
+		}
+		fmt.Fprintf(ctx, options, file, line)
+	}, nil
+}
+
+// makeFunctionFrag makes a fragment that prints some part of the
+// calling function's name
+func makeFunctionFrag(options string, part func(string) string) fragmentFormatter {
+	options = stringopt(options)
+	return func(ctx *OutputContext) {
+		_, _, function, _ := ctx.src.callSite(ctx.stackSkip)
+		if function == "" {
+			function = "???"
+		} else {
+			function = part(function)
+		}
+		fmt.Fprintf(ctx, options, function)
+	}
+}
+
+func makeFuncFrag(options string) (fragmentFormatter, error) {
+	return makeFunctionFrag(options, func(name string) string {
+		_, short := splitFuncName(name)
+		return short
+	}), nil
+}
+
+func makeLongFuncFrag(options string) (fragmentFormatter, error) {
+	return makeFunctionFrag(options, func(name string) string {
+		return name
+	}), nil
+}
+
+func makePackageFrag(options string) (fragmentFormatter, error) {
+	return makeFunctionFrag(options, func(name string) string {
+		pkg, _ := splitFuncName(name)
+		return pkg
+	}), nil
+}
+
+func makeGoroutineFrag(options string) (fragmentFormatter, error) {
+	// from now on, capture the goroutine along with the call site
+	atomic.StoreInt32(&wantGoroutine, 1)
+	if options == "" {
+		options = "%d"
+	} else {
+		options = "%" + options
+	}
+	return func(ctx *OutputContext) {
+		fmt.Fprintf(ctx, options, ctx.src.goroutine())
+	}, nil
+}
@@ -7,7 +7,7 @@ import (
 	"strings"
 )
 
-func colorResetFrag(ctx *outputContext) {
+func colorResetFrag(ctx *OutputContext) {
 	// bypass the ctx.Write() layer because we don't want this to
 	// count against our columns
 	ctx.dst.Write([]byte("\033[0m"))
@@ -53,7 +53,7 @@ func makeColorFrag(options string) (fragmentFormatter, error) {
 		colors[i] = color
 	}
 
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		ctx.dst.Write(colors[ctx.src.Level])
 	}, nil
 
@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A condition is the test in a %{if ...} section of a pattern.  The
+// conditions are:
+//
+//	annot/key          the record has the annotation
+//	annot/key=value    ...with the given value (which may be a glob)
+//	module=pattern     the module matches, as for LevelFilter.SetLevel
+//	level<=ERROR       the level compares so (with any of <, <=, ==,
+//	                   !=, >= and >); levels compare by number, so
+//	                   this is ERROR and anything more severe
+//
+// and any of them can be negated with a leading '!'.
+type condition func(*Record) bool
+
+func compileCondition(s string) (condition, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "!") {
+		c, err := compileCondition(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		return func(rec *Record) bool {
+			return !c(rec)
+		}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(s, "annot/"):
+		m := &AnnotMatch{Key: s[6:]}
+		if eq := strings.IndexByte(m.Key, '='); eq >= 0 {
+			value := m.Key[eq+1:]
+			m.Key = m.Key[:eq]
+			if strings.ContainsAny(value, "*?[\\") {
+				m.Glob = value
+			} else {
+				m.Values = []string{value}
+			}
+		}
+		if m.Key == "" {
+			break
+		}
+		return m.Match, nil
+
+	case strings.HasPrefix(s, "module="):
+		pattern := s[7:]
+		return func(rec *Record) bool {
+			return matchModule(pattern, rec.Module)
+		}, nil
+
+	case strings.HasPrefix(s, "level"):
+		return compileLevelCondition(strings.TrimSpace(s[5:]))
+	}
+	return nil, fmt.Errorf("logger: invalid condition %q", s)
+}
+
+var levelOps = []struct {
+	op   string
+	test func(a, b Level) bool
+}{
+	// the two-character ones first, so "<=" isn't taken for "<"
+	{"<=", func(a, b Level) bool { return a <= b }},
+	{">=", func(a, b Level) bool { return a >= b }},
+	{"==", func(a, b Level) bool { return a == b }},
+	{"!=", func(a, b Level) bool { return a != b }},
+	{"<", func(a, b Level) bool { return a < b }},
+	{">", func(a, b Level) bool { return a > b }},
+	{"=", func(a, b Level) bool { return a == b }},
+}
+
+func compileLevelCondition(s string) (condition, error) {
+	for _, op := range levelOps {
+		if !strings.HasPrefix(s, op.op) {
+			continue
+		}
+		level, err := ParseLevel(strings.TrimSpace(s[len(op.op):]))
+		if err != nil {
+			return nil, err
+		}
+		test := op.test
+		return func(rec *Record) bool {
+			return test(rec.Level, level)
+		}, nil
+	}
+	return nil, fmt.Errorf("logger: invalid condition %q", "level"+s)
+}
+
+// A section is the part of a pattern between %{if ...} and %{end},
+// which is compiled (once) into a fragment that runs one branch or
+// the other
+type section struct {
+	cond            condition
+	then, otherwise fragmentList
+	inElse          bool
+}
+
+type fragmentList struct {
+	frags   []fragmentFormatter
+	nocolor []fragmentFormatter
+}
+
+func (l *fragmentList) push(ff fragmentFormatter, iscolor bool) {
+	l.frags = append(l.frags, ff)
+	if !iscolor {
+		l.nocolor = append(l.nocolor, ff)
+	}
+}
+
+// branches returns the fragment that runs the one branch or the other
+func branches(cond condition, then, otherwise []fragmentFormatter) fragmentFormatter {
+	return func(ctx *OutputContext) {
+		frags := otherwise
+		if cond(ctx.src) {
+			frags = then
+		}
+		// the fragments are a frame further from the caller in here
+		ctx.stackSkip++
+		for _, frag := range frags {
+			frag(ctx)
+		}
+		ctx.stackSkip--
+	}
+}
+
+func (s *section) push(parent *fragmentList) {
+	parent.frags = append(parent.frags,
+		branches(s.cond, s.then.frags, s.otherwise.frags))
+	parent.nocolor = append(parent.nocolor,
+		branches(s.cond, s.then.nocolor, s.otherwise.nocolor))
+}
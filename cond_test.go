@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+func formatPlain(t *testing.T, pat string, rec *Record) string {
+	t.Helper()
+	f, err := PatternFormatter(pat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(f.Format(rec, true, 1))
+}
+
+func TestConditionalSections(t *testing.T) {
+	pat := "%{if annot/req}[req=%{annot/req}] %{end}" +
+		"%{if level<=ERROR}! %{else}%{if module=db}DB %{else}-- %{end}%{end}" +
+		"%{if !annot/user=ac*}anon %{end}%{message}"
+	cases := []struct {
+		rec  *Record
+		want string
+	}{
+		{&Record{Module: "web", Level: ERROR, Format: "a",
+			Annotations: map[string]interface{}{"req": "7"}}, "[req=7] ! anon a"},
+		{&Record{Module: "db.pool", Level: INFO, Format: "b",
+			Annotations: map[string]interface{}{"user": "acme"}}, "DB b"},
+		{&Record{Module: "web", Level: DEBUG, Format: "c",
+			Annotations: map[string]interface{}{"user": "bob"}}, "-- anon c"},
+	}
+	for _, c := range cases {
+		if got := formatPlain(t, pat, c.rec); got != c.want {
+			t.Errorf("expected %q, got %q", c.want, got)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	rec := &Record{Module: "db.pool", Level: WARNING,
+		Annotations: map[string]interface{}{"job": "nightly-7"}}
+	for cond, want := range map[string]bool{
+		"annot/job":            true,
+		"annot/req":            false,
+		"annot/job=nightly-7":  true,
+		"annot/job=nightly-*":  true,
+		"annot/job=weekly-*":   false,
+		"!annot/job":           false,
+		"module=db":            true,
+		"module=db.*":          true,
+		"module=web":           false,
+		"level<=ERROR":         false,
+		"level <= WARNING":     true,
+		"level==warning":       true,
+		"level=WARNING":        true,
+		"level!=WARNING":       false,
+		"level>ERROR":          true,
+		"level<WARNING":        false,
+		"level>=DEBUG":         false,
+		"!level>=DEBUG":        true,
+		"!!module=db":          true,
+		" annot/job=nightly-7": true,
+	} {
+		c, err := compileCondition(cond)
+		if err != nil {
+			t.Errorf("%q: %s", cond, err)
+			continue
+		}
+		if got := c(rec); got != want {
+			t.Errorf("%q: expected %v, got %v", cond, want, got)
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	for _, pat := range []string{
+		"%{if bogus}x%{end}",
+		"%{if annot/x}",
+		"%{end}",
+		"%{else}",
+		"%{if level<=LOUD}%{end}",
+		"%{if level}%{end}",
+		"%{if annot/}%{end}",
+		"%{if annot/a}%{else}%{else}%{end}",
+	} {
+		if _, err := PatternFormatter(pat); err == nil {
+			t.Errorf("expected %q to be rejected", pat)
+		}
+	}
+}
+
+func TestConditionalCallerAndMatch(t *testing.T) {
+	f := MustPatternFormatter("%{if level<=ERROR}%{shortfile} %{end}%{annot/req}%{if annot/user}%{annot/user}%{end}")
+	rec := &Record{Level: ERROR, Annotations: map[string]interface{}{"req": "r"}}
+
+	// the caller is found from inside a section just as well
+	got := string(f.Format(rec, true, 1))
+	if !strings.HasPrefix(got, "cond_test.go:") {
+		t.Fatalf("expected the caller, got %q", got)
+	}
+
+	// only the annotations printed unconditionally are required
+	if !f.Match(rec) {
+		t.Fatalf("expected a match without the conditional annotation")
+	}
+	if f.Match(&Record{Level: ERROR}) {
+		t.Fatalf("expected no match without the required annotation")
+	}
+}
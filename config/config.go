@@ -0,0 +1,634 @@
+// Package config builds a tree of logging writers from a JSON
+// description, so that a program's logging setup can be changed
+// without changing the program.  A document looks like:
+//
+//	{
+//	  "formatters": {
+//	    "console": {"type": "pattern", "pattern": "%{color}%{time:15:04:05} %{level:-8s}%{/color} %{message}\n"},
+//	    "json":    {"type": "structured"}
+//	  },
+//	  "writers": {
+//	    "out":   {"type": "stdout", "formatter": "console", "color": "auto"},
+//	    "audit": {"type": "file", "path": "/var/log/app/audit.log", "formatter": "json"},
+//	    "route": {"type": "router", "fallback": "out", "routes": [
+//	      {"annotations": [{"key": "audit"}], "target": "audit", "stop": true}
+//	    ]},
+//	    "main":  {"type": "filter", "target": "route", "levels": "*=info,db=debug"}
+//	  },
+//	  "root": "main"
+//	}
+//
+// Formatter types are "pattern" (a PatternFormatter), "structured"
+// (JSON, from the structured package) and "logfmt".  Writer types
+// are "stdout", "stderr", "file" and "network", which write using a
+// formatter, and "filter", "router", "fanout" and "failover", which
+// pass records on to other writers by name.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dkolbly/logging"
+	"github.com/dkolbly/logging/structured"
+	"github.com/mattn/go-isatty"
+)
+
+// Config is the JSON description of a writer tree
+type Config struct {
+	Formatters map[string]*FormatterSpec `json:"formatters"`
+	Writers    map[string]*WriterSpec    `json:"writers"`
+	Root       string                    `json:"root"`
+}
+
+type FormatterSpec struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type WriterSpec struct {
+	Type string `json:"type"`
+
+	// for stdout, stderr, file and network
+	Formatter string     `json:"formatter,omitempty"`
+	Color     string     `json:"color,omitempty"` // "auto", "always" or "never"
+	Path      string     `json:"path,omitempty"`
+	Network   string     `json:"network,omitempty"`
+	Address   string     `json:"address,omitempty"`
+	Spool     *SpoolSpec `json:"spool,omitempty"`
+
+	// for filter, router, fanout and failover
+	Target     string          `json:"target,omitempty"`
+	Targets    []string        `json:"targets,omitempty"`
+	Levels     string          `json:"levels,omitempty"`
+	RateLimits []RateLimitSpec `json:"rate_limits,omitempty"`
+	Routes     []RouteSpec     `json:"routes,omitempty"`
+	Fallback   string          `json:"fallback,omitempty"`
+	QueueLen   int             `json:"queue_len,omitempty"`
+}
+
+// SpoolSpec puts a network writer behind a logging.Spool
+type SpoolSpec struct {
+	Dir         string `json:"dir"`
+	SegmentSize int64  `json:"segment_size,omitempty"`
+	MaxBytes    int64  `json:"max_bytes,omitempty"`
+	Retry       string `json:"retry,omitempty"`
+}
+
+type RateLimitSpec struct {
+	Module string  `json:"module"`
+	Rate   float64 `json:"rate"`
+	Burst  int     `json:"burst"`
+	Exempt string  `json:"exempt,omitempty"`
+}
+
+// A RouteSpec describes a logging.Route.  Levels is either a single
+// level, selecting that level and everything more severe, or a range
+// like "notice..info".
+type RouteSpec struct {
+	Module      string      `json:"module,omitempty"`
+	Levels      string      `json:"levels,omitempty"`
+	Annotations []AnnotSpec `json:"annotations,omitempty"`
+	Stop        bool        `json:"stop,omitempty"`
+	Target      string      `json:"target"`
+}
+
+type AnnotSpec struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values,omitempty"`
+	Glob   string   `json:"glob,omitempty"`
+}
+
+// An Error pinpoints the part of the document that is wrong, as a
+// dotted path like "writers.main.target"
+type Error struct {
+	Path string
+	Err  error
+}
+
+func (err *Error) Error() string {
+	return err.Path + ": " + err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+func errorf(path string, format string, args ...interface{}) error {
+	return &Error{path, fmt.Errorf(format, args...)}
+}
+
+// Parse decodes a configuration document.  Syntax errors are reported
+// with their line and column, and unknown fields are errors.
+func Parse(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		var syntax *json.SyntaxError
+		var typ *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntax):
+			return nil, errorAt(data, syntax.Offset, err)
+		case errors.As(err, &typ):
+			return nil, errorAt(data, typ.Offset, fmt.Errorf("%s should be %s, not %s", typ.Field, typ.Type, typ.Value))
+		}
+		return nil, errorAt(data, dec.InputOffset(), err)
+	}
+	return &c, nil
+}
+
+func errorAt(data []byte, offset int64, err error) error {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+// Load reads and parses a configuration file
+func Load(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return c, nil
+}
+
+// A Pipeline is a writer tree built from a Config.  It is itself a
+// Writer (feeding its root) and owns the files, connections and
+// goroutines of the writers in it, which Close shuts down.
+type Pipeline struct {
+	cfg     *Config
+	root    logging.Writer
+	writers map[string]logging.Writer
+	spools  []*pipelineSpool
+	pending []*pipelineSpool // waiting for the pipeline replaced to close
+	closers []io.Closer
+	close   sync.Once
+	err     error
+}
+
+func (p *Pipeline) Write(rec *logging.Record, skip int) {
+	p.root.Write(rec, skip+1)
+}
+
+// Writer returns the writer with the given name in the configuration,
+// or nil if there is none
+func (p *Pipeline) Writer(name string) logging.Writer {
+	return p.writers[name]
+}
+
+// Filter returns the "filter" writer with the given name, or nil if
+// there is none, so that it can be controlled at run time (with
+// admin.New or CycleOnSignals, say)
+func (p *Pipeline) Filter(name string) *logging.LevelFilter {
+	lf, _ := p.writers[name].(*logging.LevelFilter)
+	return lf
+}
+
+// Filters returns the names of the "filter" writers in the pipeline
+func (p *Pipeline) Filters() []string {
+	var names []string
+	for name, w := range p.writers {
+		if _, ok := w.(*logging.LevelFilter); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the writers in the pipeline, outermost first so that
+// queued records are drained into the writers that are still open
+func (p *Pipeline) Close() error {
+	p.close.Do(func() {
+		for i := len(p.closers) - 1; i >= 0; i-- {
+			if err := p.closers[i].Close(); err != nil && p.err == nil {
+				p.err = err
+			}
+		}
+	})
+	return p.err
+}
+
+type builder struct {
+	cfg        *Config
+	formatters map[string]logging.Formatter
+	writers    map[string]logging.Writer
+	building   map[string]bool
+	closers    []io.Closer
+	spools     []*pipelineSpool
+	replacing  *Pipeline
+	pending    []*pipelineSpool
+}
+
+// Build checks the configuration and builds the writer tree it
+// describes.  Nothing is left open if it fails.  A spool directory
+// can only be used by one pipeline at a time, so building a pipeline
+// that spools to the same place as an open one fails (but see Watch).
+func (c *Config) Build() (*Pipeline, error) {
+	return c.build(nil)
+}
+
+// build builds the pipeline that is to replace another one, which
+// may still be open; the spools they share are opened by start once
+// the old one is closed
+func (c *Config) build(replacing *Pipeline) (*Pipeline, error) {
+	b := &builder{
+		cfg:        c,
+		formatters: make(map[string]logging.Formatter),
+		writers:    make(map[string]logging.Writer),
+		building:   make(map[string]bool),
+		replacing:  replacing,
+	}
+	root, err := b.build()
+	if err != nil {
+		for i := len(b.closers) - 1; i >= 0; i-- {
+			b.closers[i].Close()
+		}
+		return nil, err
+	}
+	return &Pipeline{
+		cfg:     c,
+		root:    root,
+		writers: b.writers,
+		spools:  b.spools,
+		pending: b.pending,
+		closers: b.closers,
+	}, nil
+}
+
+func (p *Pipeline) spoolsTo(dir string) bool {
+	for _, ps := range p.spools {
+		if ps.dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// start opens the spools that had to wait for the pipeline this one
+// replaced to be closed.  If one can't be opened, its network writer
+// is used without a spool.
+func (p *Pipeline) start() error {
+	var first error
+	for _, ps := range p.pending {
+		if err := ps.open(); err != nil && first == nil {
+			first = err
+		}
+	}
+	p.pending = nil
+	return first
+}
+
+func (b *builder) build() (logging.Writer, error) {
+	var names []string
+	for name := range b.cfg.Formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := b.formatter(name, "formatters."+name); err != nil {
+			return nil, err
+		}
+	}
+	if b.cfg.Root == "" {
+		return nil, errorf("root", "missing")
+	}
+	root, err := b.writer(b.cfg.Root, "root")
+	if err != nil {
+		return nil, err
+	}
+	// make sure the writers that aren't used are valid too
+	names = names[:0]
+	for name := range b.cfg.Writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := b.writer(name, "writers"); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+func (b *builder) formatter(name, path string) (logging.Formatter, error) {
+	if f, ok := b.formatters[name]; ok {
+		return f, nil
+	}
+	spec, ok := b.cfg.Formatters[name]
+	if !ok || spec == nil {
+		return nil, errorf(path, "unknown formatter %q", name)
+	}
+	path = "formatters." + name
+
+	var f logging.Formatter
+	switch spec.Type {
+	case "pattern":
+		if spec.Pattern == "" {
+			return nil, errorf(path+".pattern", "missing")
+		}
+		pf, err := logging.PatternFormatter(spec.Pattern)
+		if err != nil {
+			return nil, &Error{path + ".pattern", err}
+		}
+		f = pf
+	case "structured":
+		f = &structured.StructuredFormatter{}
+	case "logfmt":
+		f = &structured.LogfmtFormatter{}
+	case "":
+		return nil, errorf(path+".type", "missing")
+	default:
+		return nil, errorf(path+".type", "unknown formatter type %q", spec.Type)
+	}
+	b.formatters[name] = f
+	return f, nil
+}
+
+// writer builds the named writer, which is referred to from path
+func (b *builder) writer(name, path string) (logging.Writer, error) {
+	if w, ok := b.writers[name]; ok {
+		return w, nil
+	}
+	spec, ok := b.cfg.Writers[name]
+	if !ok || spec == nil {
+		return nil, errorf(path, "unknown writer %q", name)
+	}
+	path = "writers." + name
+	if b.building[name] {
+		return nil, errorf(path, "refers to itself")
+	}
+	b.building[name] = true
+	defer delete(b.building, name)
+
+	w, err := b.makeWriter(spec, path)
+	if err != nil {
+		return nil, err
+	}
+	if cl, ok := w.(io.Closer); ok {
+		b.closers = append(b.closers, cl)
+	}
+	b.writers[name] = w
+	return w, nil
+}
+
+// DefaultPattern is the format used by stdout, stderr and file writers
+// that don't name a formatter
+const DefaultPattern = "%{color}%{time:15:04:05.000} %{level:-8s} [%{module}|%{shortfile:%s:%d}]%{/color} %{leftmargin}%{message}\n"
+
+func (b *builder) textFormatter(spec *WriterSpec, path string) (logging.Formatter, error) {
+	if spec.Formatter == "" {
+		return logging.PatternFormatter(DefaultPattern)
+	}
+	return b.formatter(spec.Formatter, path+".formatter")
+}
+
+func colorOption(spec *WriterSpec, path string, f *os.File) (bool, error) {
+	switch spec.Color {
+	case "", "auto":
+		return !isatty.IsTerminal(f.Fd()), nil
+	case "always":
+		return false, nil
+	case "never":
+		return true, nil
+	}
+	return false, errorf(path+".color", "should be auto, always or never, not %q", spec.Color)
+}
+
+func (b *builder) makeWriter(spec *WriterSpec, path string) (logging.Writer, error) {
+	switch spec.Type {
+	case "stdout", "stderr":
+		dest := os.Stdout
+		if spec.Type == "stderr" {
+			dest = os.Stderr
+		}
+		f, err := b.textFormatter(spec, path)
+		if err != nil {
+			return nil, err
+		}
+		nocolor, err := colorOption(spec, path, dest)
+		if err != nil {
+			return nil, err
+		}
+		w := logging.NewTextWriterUsing(dest, f)
+		w.NoColor = nocolor
+		return w, nil
+
+	case "file":
+		if spec.Path == "" {
+			return nil, errorf(path+".path", "missing")
+		}
+		f, err := b.textFormatter(spec, path)
+		if err != nil {
+			return nil, err
+		}
+		// files aren't terminals, so "auto" means no color
+		switch spec.Color {
+		case "", "auto", "always", "never":
+		default:
+			return nil, errorf(path+".color", "should be auto, always or never, not %q", spec.Color)
+		}
+		w, err := logging.OpenFile(spec.Path, f)
+		if err != nil {
+			return nil, &Error{path + ".path", err}
+		}
+		if spec.Color == "always" {
+			w.NoColor = false
+		}
+		return w, nil
+
+	case "network":
+		if spec.Network == "" {
+			spec.Network = "tcp"
+		}
+		if spec.Address == "" {
+			return nil, errorf(path+".address", "missing")
+		}
+		if spec.Formatter == "" {
+			return nil, errorf(path+".formatter", "missing")
+		}
+		f, err := b.formatter(spec.Formatter, path+".formatter")
+		if err != nil {
+			return nil, err
+		}
+		nw := logging.NewNetWriter(spec.Network, spec.Address, f)
+		if spec.Spool == nil {
+			return nw, nil
+		}
+		return b.spool(spec.Spool, nw, path+".spool")
+
+	case "filter":
+		target, err := b.target(spec.Target, path+".target")
+		if err != nil {
+			return nil, err
+		}
+		lf := logging.MustFilter(target)
+		if err := lf.ApplySpec(spec.Levels); err != nil {
+			return nil, &Error{path + ".levels", err}
+		}
+		for i, rl := range spec.RateLimits {
+			limit, err := rateLimit(rl, fmt.Sprintf("%s.rate_limits[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			lf.SetRateLimit(limit, rl.Module)
+		}
+		return lf, nil
+
+	case "router":
+		var routes []logging.Route
+		for i, rs := range spec.Routes {
+			route, err := b.route(rs, fmt.Sprintf("%s.routes[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, route)
+		}
+		r := logging.NewRouter(routes...)
+		if spec.Fallback != "" {
+			fb, err := b.writer(spec.Fallback, path+".fallback")
+			if err != nil {
+				return nil, err
+			}
+			r.Fallback = fb
+		}
+		return r, nil
+
+	case "fanout", "failover":
+		if len(spec.Targets) == 0 {
+			return nil, errorf(path+".targets", "missing")
+		}
+		var targets []logging.Writer
+		for i, name := range spec.Targets {
+			w, err := b.writer(name, fmt.Sprintf("%s.targets[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, w)
+		}
+		if spec.Type == "fanout" {
+			return logging.NewFanOut(spec.QueueLen, targets...), nil
+		}
+		return logging.NewFailover(targets[0], targets[1:]...), nil
+
+	case "":
+		return nil, errorf(path+".type", "missing")
+	}
+	return nil, errorf(path+".type", "unknown writer type %q", spec.Type)
+}
+
+func (b *builder) target(name, path string) (logging.Writer, error) {
+	if name == "" {
+		return nil, errorf(path, "missing")
+	}
+	return b.writer(name, path)
+}
+
+func rateLimit(spec RateLimitSpec, path string) (logging.RateLimit, error) {
+	limit := logging.RateLimit{
+		Rate:  spec.Rate,
+		Burst: spec.Burst,
+	}
+	if spec.Module == "" {
+		return limit, errorf(path+".module", "missing")
+	}
+	if spec.Rate <= 0 {
+		return limit, errorf(path+".rate", "should be positive")
+	}
+	if spec.Burst < 1 {
+		return limit, errorf(path+".burst", "should be at least 1")
+	}
+	if spec.Exempt != "" {
+		level, err := logging.ParseLevel(spec.Exempt)
+		if err != nil {
+			return limit, &Error{path + ".exempt", err}
+		}
+		limit.Exempt = &level
+	}
+	return limit, nil
+}
+
+func (b *builder) route(spec RouteSpec, path string) (logging.Route, error) {
+	route := logging.Route{
+		Stop: spec.Stop,
+	}
+	route.Module = spec.Module
+	if spec.Levels != "" {
+		levels, err := parseLevels(spec.Levels)
+		if err != nil {
+			return route, &Error{path + ".levels", err}
+		}
+		route.Levels = levels
+	}
+	for i, a := range spec.Annotations {
+		if a.Key == "" {
+			return route, errorf(fmt.Sprintf("%s.annotations[%d].key", path, i), "missing")
+		}
+		route.Annots = append(route.Annots, logging.AnnotMatch{
+			Key:    a.Key,
+			Values: a.Values,
+			Glob:   a.Glob,
+		})
+	}
+	target, err := b.target(spec.Target, path+".target")
+	if err != nil {
+		return route, err
+	}
+	route.Target = target
+	return route, nil
+}
+
+func parseLevels(s string) (*logging.LevelRange, error) {
+	if dots := strings.Index(s, ".."); dots >= 0 {
+		from, err := logging.ParseLevel(s[:dots])
+		if err != nil {
+			return nil, err
+		}
+		to, err := logging.ParseLevel(s[dots+2:])
+		if err != nil {
+			return nil, err
+		}
+		return logging.Levels(from, to), nil
+	}
+	level, err := logging.ParseLevel(s)
+	if err != nil {
+		return nil, err
+	}
+	return logging.AtLeast(level), nil
+}
+
+// Install makes the pipeline the target of the DefaultBackend
+func Install(p *Pipeline) {
+	logging.DefaultBackend.Swap(p)
+}
+
+// LoadAndInstall loads a configuration file, builds it and installs
+// it as the target of the DefaultBackend
+func LoadAndInstall(file string) (*Pipeline, error) {
+	c, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	Install(p)
+	return p, nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package config
+
+import (
+	"os"
+)
+
+// there is no SIGHUP here; changes are picked up by polling only
+func notifyHangup(ch chan os.Signal) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyHangup(ch chan os.Signal) (stop func()) {
+	signal.Notify(ch, syscall.SIGHUP)
+	return func() {
+		signal.Stop(ch)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dkolbly/logging"
+)
+
+// spoolDirs are the spool directories in use by open pipelines.  Two
+// spools on one directory would each replay (and overwrite) the
+// other's segments, so a directory can only be opened once at a time.
+var spoolDirs = struct {
+	sync.Mutex
+	inUse map[string]bool
+}{inUse: make(map[string]bool)}
+
+// maxHeld is how many records a pipelineSpool holds on to while it
+// waits for its directory
+const maxHeld = 4096
+
+// A pipelineSpool is the spool of a network writer in a pipeline.
+// When a pipeline replaces another that spools to the same directory,
+// the new spool can't be opened until the old one is closed, so until
+// then the records written to it are held in memory.
+type pipelineSpool struct {
+	dir    string
+	target logging.FallibleWriter
+	cfg    logging.SpoolConfig
+
+	lock   sync.Mutex
+	spool  *logging.Spool
+	failed bool // couldn't open the spool, so write to the target
+	held   []*logging.Record
+	closed bool
+}
+
+func (ps *pipelineSpool) Write(rec *logging.Record, skip int) {
+	ps.lock.Lock()
+	switch {
+	case ps.spool != nil:
+		s := ps.spool
+		ps.lock.Unlock()
+		s.Write(rec, skip+1)
+		return
+	case ps.failed:
+		ps.lock.Unlock()
+		ps.target.Write(rec, skip+1)
+		return
+	case !ps.closed && len(ps.held) < maxHeld:
+		ps.held = append(ps.held, rec.Snapshot(skip+1))
+	}
+	ps.lock.Unlock()
+}
+
+// open opens the spool, once nobody else is using the directory
+func (ps *pipelineSpool) open() error {
+	spoolDirs.Lock()
+	if spoolDirs.inUse[ps.dir] {
+		spoolDirs.Unlock()
+		return fmt.Errorf("spool directory %s is already in use", ps.dir)
+	}
+	spoolDirs.inUse[ps.dir] = true
+	spoolDirs.Unlock()
+
+	s, err := logging.NewSpool(ps.dir, ps.target, ps.cfg)
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if err != nil || ps.closed {
+		release(ps.dir)
+		if s != nil {
+			s.Close()
+		}
+		ps.failed = err != nil
+		ps.held = nil
+		return err
+	}
+	ps.spool = s
+	for _, rec := range ps.held {
+		s.Write(rec, 1)
+	}
+	ps.held = nil
+	return nil
+}
+
+func (ps *pipelineSpool) Close() error {
+	ps.lock.Lock()
+	ps.closed = true
+	s := ps.spool
+	ps.spool = nil
+	ps.held = nil
+	ps.lock.Unlock()
+
+	if s == nil {
+		return nil
+	}
+	err := s.Close()
+	release(ps.dir)
+	return err
+}
+
+func release(dir string) {
+	spoolDirs.Lock()
+	delete(spoolDirs.inUse, dir)
+	spoolDirs.Unlock()
+}
+
+func (b *builder) spool(spec *SpoolSpec, target logging.FallibleWriter, path string) (logging.Writer, error) {
+	if spec.Dir == "" {
+		return nil, errorf(path+".dir", "missing")
+	}
+	dir, err := filepath.Abs(spec.Dir)
+	if err != nil {
+		return nil, &Error{path + ".dir", err}
+	}
+	ps := &pipelineSpool{
+		dir:    dir,
+		target: target,
+		cfg: logging.SpoolConfig{
+			SegmentSize: spec.SegmentSize,
+			MaxBytes:    spec.MaxBytes,
+		},
+	}
+	if spec.Retry != "" {
+		d, err := time.ParseDuration(spec.Retry)
+		if err != nil {
+			return nil, &Error{path + ".retry", err}
+		}
+		ps.cfg.RetryInterval = d
+	}
+	// the spool doesn't close its target, so we need to
+	if cl, ok := target.(io.Closer); ok {
+		b.closers = append(b.closers, cl)
+	}
+	b.spools = append(b.spools, ps)
+	if b.replacing != nil && b.replacing.spoolsTo(dir) {
+		// opened once the pipeline being replaced is closed
+		b.pending = append(b.pending, ps)
+		return ps, nil
+	}
+	if err := ps.open(); err != nil {
+		return nil, &Error{path + ".dir", err}
+	}
+	return ps, nil
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dkolbly/logging"
+)
+
+var log = logging.New("logging.config")
+
+// A Watcher keeps the DefaultBackend in line with a configuration
+// file, reloading it when the file changes (which is checked for by
+// polling) or the process gets a SIGHUP.  A new configuration is
+// built completely before it is swapped in, after which the old
+// pipeline is closed once the writes under way have finished with
+// it.  If the new configuration is invalid, the error is logged
+// (through the old one, which stays in place).
+//
+// Temporary level overrides carry over to the filter of the same name
+// in the new configuration, as do changes made to its rules while
+// running (unless the file changes that filter's levels too), and a
+// spool directory used by both the old and the new configuration is
+// handed over (with the records written in between held in memory)
+// rather than opened twice.  Anything holding on to a filter, such as
+// an admin.Handler or CycleOnSignals, should be moved over to the new
+// one by an OnReload hook.
+type Watcher struct {
+	file     string
+	interval time.Duration
+
+	lock    sync.Mutex
+	current *Pipeline
+	data    []byte
+	modTime time.Time
+	size    int64
+	hooks   []func(*Pipeline)
+
+	stop sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+const defaultPollInterval = 5 * time.Second
+
+// Watch loads and installs the configuration in the file, and then
+// watches it for changes, checking every interval (or every few
+// seconds if interval is 0).  An error is returned if the initial
+// configuration can't be loaded.
+func Watch(file string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	w := &Watcher{
+		file:     file,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.watch()
+	return w, nil
+}
+
+func (w *Watcher) watch() {
+	defer w.wg.Done()
+
+	hup := make(chan os.Signal, 1)
+	stop := notifyHangup(hup)
+	defer stop()
+
+	tick := time.NewTicker(w.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-hup:
+			log.Notice("reloading %s on SIGHUP", w.file)
+			if err := w.Reload(); err != nil {
+				log.Error("keeping the current configuration: %s", err)
+			}
+		case <-tick.C:
+			if !w.changed() {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				log.Error("keeping the current configuration: %s", err)
+			}
+		}
+	}
+}
+
+// changed checks (cheaply) whether the file looks like it changed
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return false
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// Current returns the pipeline in place
+func (w *Watcher) Current() *Pipeline {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.current
+}
+
+// OnReload arranges for fn to be called with each new pipeline once
+// it has been swapped in
+func (w *Watcher) OnReload(fn func(*Pipeline)) {
+	w.lock.Lock()
+	w.hooks = append(w.hooks, fn)
+	w.lock.Unlock()
+}
+
+// Reload reads the file and, if its contents are different and valid,
+// swaps the configuration it describes into the DefaultBackend
+func (w *Watcher) Reload() error {
+	p, hooks, err := w.reload()
+	if p != nil {
+		for _, fn := range hooks {
+			fn(p)
+		}
+	}
+	return err
+}
+
+// reload does the work of Reload, returning the new pipeline (if
+// there is one) and the hooks to call with it once the lock is let go
+func (w *Watcher) reload() (*Pipeline, []func(*Pipeline), error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(w.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	if w.current != nil && bytes.Equal(data, w.data) {
+		// touched but not changed
+		return nil, nil, nil
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, nil, &Error{w.file, err}
+	}
+	old := w.current
+	p, err := c.build(old)
+	if err != nil {
+		return nil, nil, &Error{w.file, err}
+	}
+	if old != nil {
+		carryOver(old, p)
+	}
+	w.current = p
+	w.data = data
+	prev := logging.DefaultBackend.Swap(p)
+	if old != nil && prev == old {
+		old.Close()
+	}
+	if err := p.start(); err != nil {
+		log.Error("%s: %s; writing without it", w.file, err)
+	}
+	log.Notice("loaded configuration from %s", w.file)
+	hooks := make([]func(*Pipeline), len(w.hooks))
+	copy(hooks, w.hooks)
+	return p, hooks, nil
+}
+
+// carryOver moves the runtime changes to the filters in the old
+// pipeline over to the filters of the same name in the new one
+func carryOver(old, p *Pipeline) {
+	for _, name := range p.Filters() {
+		from := old.Filter(name)
+		if from == nil {
+			continue
+		}
+		to := p.Filter(name)
+		if old.cfg.Writers[name].Levels == p.cfg.Writers[name].Levels {
+			to.SetRules(from.Rules())
+		}
+		to.AdoptOverrides(from)
+	}
+}
+
+// Stop stops watching the file; the current configuration stays in place
+func (w *Watcher) Stop() {
+	w.stop.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+	})
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dkolbly/logging"
+)
+
+func writeConfig(t *testing.T, file, out, levels string) {
+	t.Helper()
+	cfg := `{
+	    "writers": {
+	        "out":  {"type": "file", "path": "` + out + `"},
+	        "main": {"type": "filter", "target": "out", "levels": "` + levels + `"}
+	    },
+	    "root": "main"
+	}`
+	if err := os.WriteFile(file, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "logging.json")
+	out1 := filepath.Join(dir, "one.log")
+	out2 := filepath.Join(dir, "two.log")
+	writeConfig(t, file, out1, "*=info")
+
+	w, err := Watch(file, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		w.Stop()
+		logging.DefaultBackend.Swap(logging.Stdout{})
+		w.Current().Close()
+	}()
+
+	var lock sync.Mutex
+	var reloaded []*Pipeline
+	w.OnReload(func(p *Pipeline) {
+		lock.Lock()
+		reloaded = append(reloaded, p)
+		lock.Unlock()
+	})
+
+	// change things at runtime, the way an admin handler would
+	p1 := w.Current()
+	p1.Filter("main").SetLevel(logging.DEBUG, "db")
+	p1.Filter("main").Override(logging.ERROR, "http", time.Minute)
+
+	// a new destination carries the changes over
+	writeConfig(t, file, out2, "*=info")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	p2 := w.Current()
+	if p2 == p1 || len(reloaded) != 1 || reloaded[0] != p2 {
+		t.Fatalf("expected the hook to get the new pipeline")
+	}
+	lf := p2.Filter("main")
+	if lf.GetLevel("db") != logging.DEBUG || lf.GetLevel("http") != logging.ERROR {
+		t.Fatalf("expected the rule and override to carry over, got %+v and %+v",
+			lf.Rules(), lf.Overrides())
+	}
+	logging.New("db").Debug("after the reload")
+	buf, _ := os.ReadFile(out2)
+	if !strings.Contains(string(buf), "after the reload") {
+		t.Fatalf("expected the record in the new file, got %q", buf)
+	}
+
+	// new levels in the file take precedence over the runtime rules,
+	// but not over the overrides
+	writeConfig(t, file, out2, "*=warning")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	lf = w.Current().Filter("main")
+	if lf.GetLevel("db") != logging.WARNING || lf.GetLevel("http") != logging.ERROR {
+		t.Fatalf("expected the file's levels and the override, got %+v and %+v",
+			lf.Rules(), lf.Overrides())
+	}
+
+	// an invalid configuration leaves things as they are
+	p3 := w.Current()
+	if err := os.WriteFile(file, []byte(`{"writers": {"out": {"type": "bogus"}}, "root": "out"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if w.Current() != p3 || len(reloaded) != 2 {
+		t.Fatalf("expected the configuration to stay in place")
+	}
+}
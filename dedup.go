@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RepeatedKey is the annotation on the summary records from a Dedup,
+// giving the number of repeats that were held back
+const RepeatedKey = "repeated"
+
+// A Dedup suppresses runs of identical records, the way syslogd
+// does.  A record with the same module, level, format and arguments
+// as the one before it, and arriving within the window of it, is
+// held back.  When the run ends (because a different record comes
+// along, or because the window passes without another repeat), a
+// single "last message repeated N times" record at the same module
+// and level, carrying the RepeatedKey annotation, is written in
+// their place.
+type Dedup struct {
+	target Writer
+	window time.Duration
+
+	lock     sync.Mutex
+	key      string
+	module   string
+	level    Level
+	lastSeen time.Time
+	repeats  int
+	timer    *time.Timer
+}
+
+func NewDedup(target Writer, window time.Duration) *Dedup {
+	return &Dedup{
+		target: target,
+		window: window,
+	}
+}
+
+func dedupKey(rec *Record) string {
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%#v", rec.Module, rec.Level, rec.Format, rec.Args)
+}
+
+func (d *Dedup) Write(rec *Record, skip int) {
+	key := dedupKey(rec)
+	now := time.Now()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if key == d.key && now.Sub(d.lastSeen) < d.window {
+		d.repeats++
+		d.lastSeen = now
+		if d.timer == nil {
+			d.timer = time.AfterFunc(d.window, d.expire)
+		} else {
+			d.timer.Reset(d.window)
+		}
+		return
+	}
+	d.flushLocked(skip + 1)
+	d.key = key
+	d.module = rec.Module
+	d.level = rec.Level
+	d.lastSeen = now
+	d.target.Write(rec, skip+1)
+}
+
+func (d *Dedup) expire() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.timer == nil {
+		return
+	}
+	// a repeat may have snuck in just before we got the lock
+	if left := d.window - time.Since(d.lastSeen); left > 0 {
+		d.timer.Reset(left)
+		return
+	}
+	d.flushLocked(1)
+	d.key = ""
+}
+
+// flushLocked writes out the summary of the current run, if there
+// were any repeats
+func (d *Dedup) flushLocked(skip int) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.repeats == 0 {
+		return
+	}
+	r := synthesize(d.module, d.level, "last message repeated %d times", d.repeats)
+	r.Annotate(RepeatedKey, d.repeats)
+	d.repeats = 0
+	d.target.Write(r, skip+1)
+}
+
+// Flush ends the current run, writing out its summary if needed
+func (d *Dedup) Flush() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.flushLocked(1)
+	d.key = ""
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupCollapsesRuns(t *testing.T) {
+	r := &recorder{}
+	d := NewDedup(r, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		d.Write(testRecord("m", WARNING, "flap %s", "x"), 0)
+	}
+	d.Write(testRecord("m", WARNING, "flap %s", "y"), 0)
+	d.Write(testRecord("m", WARNING, "flap %s", "y"), 0)
+	d.Flush()
+
+	want := []string{
+		"flap x",
+		"last message repeated 4 times",
+		"flap y",
+		"last message repeated 1 times",
+	}
+	if got := r.messages(); !sameStrings(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	recs := r.records()
+	if rec := recs[1]; rec.Module != "m" || rec.Level != WARNING || rec.Annotations[RepeatedKey] != 4 {
+		t.Fatalf("unexpected summary %+v", rec)
+	}
+
+	// a flush with no run in progress writes nothing, and the next
+	// record starts afresh
+	d.Flush()
+	d.Write(testRecord("m", WARNING, "flap %s", "y"), 0)
+	if got := r.messages(); len(got) != 5 || got[4] != "flap y" {
+		t.Fatalf("expected a fresh run, got %q", got)
+	}
+}
+
+func TestDedupDistinguishesLevels(t *testing.T) {
+	r := &recorder{}
+	d := NewDedup(r, time.Hour)
+	d.Write(testRecord("m", WARNING, "same"), 0)
+	d.Write(testRecord("m", ERROR, "same"), 0)
+	d.Write(testRecord("n", ERROR, "same"), 0)
+	if got := r.messages(); len(got) != 3 {
+		t.Fatalf("expected nothing to be held back, got %q", got)
+	}
+}
+
+func TestDedupWindowExpires(t *testing.T) {
+	r := &recorder{}
+	d := NewDedup(r, 20*time.Millisecond)
+
+	d.Write(testRecord("m", INFO, "tick"), 0)
+	d.Write(testRecord("m", INFO, "tick"), 0)
+	d.Write(testRecord("m", INFO, "tick"), 0)
+	// the summary goes out on its own once the window passes
+	eventually(t, "the summary", func() bool {
+		return len(r.records()) == 2
+	})
+	if got := r.messages()[1]; got != "last message repeated 2 times" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	// and after that, the same record is not a repeat
+	d.Write(testRecord("m", INFO, "tick"), 0)
+	if got := r.messages(); len(got) != 3 || got[2] != "tick" {
+		t.Fatalf("expected a fresh run, got %q", got)
+	}
+}
@@ -1,5 +1,10 @@
 package logging
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // A MutableWriter is the one log writer that is designed to be mutable,
 // and is primarily used as the default log destination so that modules
 // can configure their logging using:
@@ -7,13 +12,80 @@ package logging
 //    var log = logging.MustGetLogger("me")
 //
 // and the main application can configure where those log messages go
-// to by resetting the Target of the DefaultBackend
+// to by resetting the Target of the DefaultBackend (or, if other
+// goroutines may be logging at the time or Swap has already been
+// used, by using Swap)
 type MutableWriter struct {
 	Target Writer
+
+	// the current generation of writes, which Swap replaces; each
+	// MutableWriter keeps its own so that writes never wait on a lock
+	gen  atomic.Value // *mutableGen
+	swap sync.Mutex   // held by Swap, which writes never take
+}
+
+// a mutableGen counts the writes in progress to one target
+type mutableGen struct {
+	w       Writer // nil for the Target set before any Swap
+	busy    int64
+	retired int32
+	drained chan struct{}
+	once    sync.Once
+}
+
+func (g *mutableGen) release() {
+	if atomic.AddInt64(&g.busy, -1) == 0 && atomic.LoadInt32(&g.retired) != 0 {
+		g.once.Do(func() { close(g.drained) })
+	}
 }
 
 func (m *MutableWriter) Write(rec *Record, skip int) {
-	m.Target.Write(rec, skip+1)
+	for {
+		g, _ := m.gen.Load().(*mutableGen)
+		if g == nil {
+			m.gen.CompareAndSwap(nil, &mutableGen{drained: make(chan struct{})})
+			continue
+		}
+		atomic.AddInt64(&g.busy, 1)
+		if atomic.LoadInt32(&g.retired) != 0 {
+			// swapped out from under us; go with the new one
+			g.release()
+			continue
+		}
+		w := g.w
+		if w == nil {
+			w = m.Target
+		}
+		w.Write(rec, skip+1)
+		g.release()
+		return
+	}
+}
+
+// Swap replaces the Target, returning the old one once every write
+// to it that was already under way has finished, so that it can
+// safely be closed
+func (m *MutableWriter) Swap(w Writer) Writer {
+	m.swap.Lock()
+	defer m.swap.Unlock()
+
+	old, _ := m.gen.Swap(&mutableGen{w: w, drained: make(chan struct{})}).(*mutableGen)
+	if old != nil {
+		atomic.StoreInt32(&old.retired, 1)
+		if atomic.LoadInt64(&old.busy) == 0 {
+			old.once.Do(func() { close(old.drained) })
+		}
+		<-old.drained
+	}
+
+	prev := m.Target
+	if old != nil && old.w != nil {
+		prev = old.w
+	}
+	// writes go through the generation from here on, but keep the
+	// field up to date for anyone looking at it
+	m.Target = w
+	return prev
 }
 
-var DefaultBackend = &MutableWriter{Stdout{}}
+var DefaultBackend = &MutableWriter{Target: Stdout{}}
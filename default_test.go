@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMutableWriterSwapWaitsForWrites(t *testing.T) {
+	first := &recorder{block: make(chan struct{})}
+	second := &recorder{}
+	m := &MutableWriter{Target: first}
+
+	wrote := make(chan struct{})
+	go func() {
+		m.Write(testRecord("m", INFO, "slow"), 0)
+		close(wrote)
+	}()
+	// let the write get under way
+	time.Sleep(10 * time.Millisecond)
+
+	swapped := make(chan Writer)
+	go func() {
+		swapped <- m.Swap(second)
+	}()
+	eventually(t, "the swap", func() bool {
+		g, _ := m.gen.Load().(*mutableGen)
+		return g != nil && g.w == second
+	})
+	// new writes go to the new target right away...
+	m.Write(testRecord("m", INFO, "fast"), 0)
+	if got := second.messages(); !sameStrings(got, []string{"fast"}) {
+		t.Fatalf("new target got %q", got)
+	}
+	// ...but Swap doesn't return until the old one is done with
+	select {
+	case <-swapped:
+		t.Fatalf("Swap returned while a write was in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(first.block)
+	if old := <-swapped; old != first {
+		t.Fatalf("Swap returned %v", old)
+	}
+	<-wrote
+	if got := first.messages(); !sameStrings(got, []string{"slow"}) {
+		t.Fatalf("old target got %q", got)
+	}
+	if m.Target != second {
+		t.Fatalf("Target should follow Swap")
+	}
+}
+
+func TestMutableWriterConcurrentSwaps(t *testing.T) {
+	m := &MutableWriter{Target: &recorder{}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				m.Write(testRecord("m", INFO, "x"), 0)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				m.Swap(&recorder{})
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Deferral collects the records logged through a context instead
+// of writing them, so that whether they get written can be decided
+// once it is known how things turned out.  The typical use is in an
+// HTTP handler:
+//
+//	ctx, d := logging.Defer(r.Context(), logging.EmitAllIf(
+//	    logging.AnyOf(logging.HasLevel(logging.ERROR), logging.SlowerThan(time.Second)),
+//	    logging.EmitNone))
+//	defer d.Commit()
+//
+// with the handler (and everything it calls) logging through
+// logging.In(ctx) or InRe(ctx), and a one-line summary of the request
+// logged the usual way.  Records logged through the context after
+// the Deferral has been committed or discarded are written straight
+// through.
+type Deferral struct {
+	lock    sync.Mutex
+	recs    []*Record
+	start   time.Time
+	outputs []Writer
+	decide  Decision
+	done    bool
+}
+
+// A Decision picks which of the records collected by a Deferral are
+// actually written when it is committed
+type Decision func(d *Deferral, recs []*Record) []*Record
+
+// A Condition is something about a Deferral (and the records it
+// collected) to base a Decision on
+type Condition func(d *Deferral, recs []*Record) bool
+
+// Defer is like Logger.Defer, using the logger in the context (or,
+// if there isn't one, an anonymous logger writing to DefaultBackend)
+func Defer(ctx context.Context, decide Decision) (context.Context, *Deferral) {
+	l, ok := ctx.Value(CurrentLoggerKey).(*Logger)
+	if !ok {
+		l = &Logger{outputs: []Writer{DefaultBackend}}
+	}
+	return l.Defer(ctx, decide)
+}
+
+// Defer returns a context carrying a logger like this one except
+// that it collects its records in the returned Deferral.  If decide
+// is nil, everything is written on Commit.
+func (l *Logger) Defer(ctx context.Context, decide Decision) (context.Context, *Deferral) {
+	if decide == nil {
+		decide = EmitAll
+	}
+	d := &Deferral{
+		start:   time.Now(),
+		outputs: l.outputs,
+		decide:  decide,
+	}
+	dl := &Logger{
+		module:  l.module,
+		annot:   l.annot,
+		outputs: []Writer{d},
+		reg:     l.reg,
+	}
+	return dl.In(ctx), d
+}
+
+func (d *Deferral) Write(rec *Record, skip int) {
+	d.lock.Lock()
+	if !d.done {
+		d.recs = append(d.recs, rec.Snapshot(skip+1))
+		d.lock.Unlock()
+		return
+	}
+	d.lock.Unlock()
+	for _, wr := range d.outputs {
+		wr.Write(rec, skip+1)
+	}
+}
+
+// Records returns the records collected so far
+func (d *Deferral) Records() []*Record {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]*Record(nil), d.recs...)
+}
+
+// Elapsed returns the time since the Deferral was created
+func (d *Deferral) Elapsed() time.Duration {
+	return time.Since(d.start)
+}
+
+// Commit writes whichever of the collected records the decision
+// function picks.  Only the first call to Commit or Discard has any
+// effect; records logged through the context from then on (including
+// while the decision is being made) are written straight through.
+func (d *Deferral) Commit() {
+	d.lock.Lock()
+	if d.done {
+		d.lock.Unlock()
+		return
+	}
+	d.done = true
+	recs := d.recs
+	d.recs = nil
+	d.lock.Unlock()
+
+	recs = d.decide(d, recs)
+	for _, rec := range recs {
+		for _, wr := range d.outputs {
+			wr.Write(rec, 1)
+		}
+	}
+}
+
+// Discard throws away the collected records
+func (d *Deferral) Discard() {
+	d.lock.Lock()
+	d.done = true
+	d.recs = nil
+	d.lock.Unlock()
+}
+
+// EmitAll is the Decision to write everything
+func EmitAll(d *Deferral, recs []*Record) []*Record {
+	return recs
+}
+
+// EmitNone is the Decision to write nothing
+func EmitNone(d *Deferral, recs []*Record) []*Record {
+	return nil
+}
+
+// EmitAtLeast decides to write only the records at least as severe
+// as the given level
+func EmitAtLeast(level Level) Decision {
+	return func(d *Deferral, recs []*Record) []*Record {
+		var lst []*Record
+		for _, rec := range recs {
+			if rec.Level <= level {
+				lst = append(lst, rec)
+			}
+		}
+		return lst
+	}
+}
+
+// EmitAllIf decides to write everything if the condition holds, and
+// otherwise leaves it up to another decision
+func EmitAllIf(cond Condition, otherwise Decision) Decision {
+	return func(d *Deferral, recs []*Record) []*Record {
+		if cond(d, recs) {
+			return recs
+		}
+		return otherwise(d, recs)
+	}
+}
+
+// HasLevel is the condition that some record is at least as severe
+// as the given level
+func HasLevel(level Level) Condition {
+	return func(d *Deferral, recs []*Record) bool {
+		for _, rec := range recs {
+			if rec.Level <= level {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SlowerThan is the condition that at least the given duration has
+// passed since the Deferral was created
+func SlowerThan(dur time.Duration) Condition {
+	return func(d *Deferral, recs []*Record) bool {
+		return d.Elapsed() >= dur
+	}
+}
+
+// AnyOf is the condition that at least one of the given ones holds
+func AnyOf(conds ...Condition) Condition {
+	return func(d *Deferral, recs []*Record) bool {
+		for _, cond := range conds {
+			if cond(d, recs) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeferDecides(t *testing.T) {
+	r := &recorder{}
+	l := New("defer").To(r)
+
+	ctx, d := l.Defer(context.Background(), EmitAllIf(HasLevel(ERROR), EmitAtLeast(WARNING)))
+	In(ctx).Debug("d1")
+	In(ctx).Warning("w1")
+	if len(r.records()) != 0 {
+		t.Fatalf("records written before Commit: %q", r.messages())
+	}
+	d.Commit()
+	if got := r.messages(); !sameStrings(got, []string{"w1"}) {
+		t.Fatalf("expected only the warning, got %q", got)
+	}
+
+	// after Commit, records go straight through
+	In(ctx).Debug("d2")
+	if got := r.messages(); !sameStrings(got, []string{"w1", "d2"}) {
+		t.Fatalf("expected records to be written after Commit, got %q", got)
+	}
+}
+
+func TestDeferWithoutLogger(t *testing.T) {
+	r := &recorder{}
+	old := DefaultBackend.Swap(r)
+	defer DefaultBackend.Swap(old)
+
+	ctx, d := Defer(context.Background(), nil)
+	In(ctx).Info("collected")
+	d.Commit()
+	if got := r.messages(); !sameStrings(got, []string{"collected"}) {
+		t.Fatalf("expected the default backend to get the record, got %q", got)
+	}
+}
@@ -0,0 +1,242 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A DemuxOpener creates the writer for one value of a Demux's key
+type DemuxOpener func(key string) (Writer, error)
+
+// A Demux splits records up by the value of an annotation (such as
+// the "job" annotation put there by Re(job(id))), giving each value
+// its own writer.  Writers are opened on demand, closed again after
+// being idle for a while, and limited in number (the least recently
+// used one being closed to make room when necessary).  Records without
+// the annotation, or whose writer could not be opened, go to the
+// Fallback if there is one.
+type Demux struct {
+	key      string
+	open     DemuxOpener
+	idle     time.Duration
+	maxOpen  int
+	Fallback Writer
+
+	lock   sync.Mutex
+	sinks  map[string]*demuxSink
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type demuxSink struct {
+	lock   sync.Mutex
+	w      Writer // nil until the first write opens it
+	closed bool
+	used   time.Time // guarded by the Demux's lock
+}
+
+// NewDemux creates a Demux on the given annotation key.  An idle
+// timeout of zero keeps writers open until they are crowded out, and
+// a maxOpen of zero means there is no limit.
+func NewDemux(key string, open DemuxOpener, idle time.Duration, maxOpen int) *Demux {
+	d := &Demux{
+		key:     key,
+		open:    open,
+		idle:    idle,
+		maxOpen: maxOpen,
+		sinks:   make(map[string]*demuxSink),
+		done:    make(chan struct{}),
+	}
+	if idle > 0 {
+		d.wg.Add(1)
+		go d.reap()
+	}
+	return d
+}
+
+func (d *Demux) Write(rec *Record, skip int) {
+	v, ok := rec.Annotations[d.key]
+	if !ok {
+		d.fallback(rec, skip+1)
+		return
+	}
+	key, ok := v.(string)
+	if !ok {
+		key = fmt.Sprint(v)
+	}
+
+	for {
+		sink, victim := d.sink(key)
+		if victim != nil {
+			victim.close()
+		}
+		if sink == nil {
+			d.fallback(rec, skip+1)
+			return
+		}
+
+		// the writer is opened (and written to) under the sink's own
+		// lock, so a slow open doesn't hold up the other keys
+		sink.lock.Lock()
+		if sink.closed {
+			// evicted or reaped before we got to it; start over
+			sink.lock.Unlock()
+			continue
+		}
+		if sink.w == nil {
+			w, err := d.open(key)
+			if err != nil {
+				sink.closed = true
+				sink.lock.Unlock()
+				d.forget(key, sink)
+				d.fallback(rec, skip+1)
+				return
+			}
+			sink.w = w
+		}
+		sink.w.Write(rec, skip+1)
+		sink.lock.Unlock()
+		return
+	}
+}
+
+// sink finds or makes room for the sink for a key, returning nil if
+// the Demux has been closed, along with any sink that was evicted to
+// make room (which the caller should close)
+func (d *Demux) sink(key string) (sink, victim *demuxSink) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return nil, nil
+	}
+	sink, ok := d.sinks[key]
+	if !ok {
+		if d.maxOpen > 0 && len(d.sinks) >= d.maxOpen {
+			victim = d.evictLocked()
+		}
+		sink = &demuxSink{}
+		d.sinks[key] = sink
+	}
+	sink.used = time.Now()
+	return sink, victim
+}
+
+// forget removes a sink whose writer could not be opened
+func (d *Demux) forget(key string, sink *demuxSink) {
+	d.lock.Lock()
+	if d.sinks[key] == sink {
+		delete(d.sinks, key)
+	}
+	d.lock.Unlock()
+}
+
+func (d *Demux) fallback(rec *Record, skip int) {
+	if d.Fallback != nil {
+		d.Fallback.Write(rec, skip+1)
+	}
+}
+
+// evictLocked takes out the least recently used writer, which the
+// caller should close once it has let go of the lock
+func (d *Demux) evictLocked() *demuxSink {
+	var oldest string
+	var when time.Time
+	for key, sink := range d.sinks {
+		if when.IsZero() || sink.used.Before(when) {
+			oldest = key
+			when = sink.used
+		}
+	}
+	sink := d.sinks[oldest]
+	delete(d.sinks, oldest)
+	return sink
+}
+
+func (s *demuxSink) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	if cl, ok := s.w.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+func (d *Demux) reap() {
+	defer d.wg.Done()
+	period := d.idle / 2
+	if period < time.Millisecond {
+		period = time.Millisecond
+	}
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-tick.C:
+			var idle []*demuxSink
+			d.lock.Lock()
+			for key, sink := range d.sinks {
+				if now.Sub(sink.used) >= d.idle {
+					delete(d.sinks, key)
+					idle = append(idle, sink)
+				}
+			}
+			d.lock.Unlock()
+			for _, sink := range idle {
+				sink.close()
+			}
+		}
+	}
+}
+
+// Keys returns the keys that currently have an open writer
+func (d *Demux) Keys() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	keys := make([]string, 0, len(d.sinks))
+	for key := range d.sinks {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Close closes all the open writers
+func (d *Demux) Close() error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return nil
+	}
+	d.closed = true
+	sinks := d.sinks
+	d.sinks = nil
+	close(d.done)
+	d.lock.Unlock()
+
+	d.wg.Wait()
+	var first error
+	for _, sink := range sinks {
+		if err := sink.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+var keySanitizer = strings.NewReplacer("/", "_", "\\", "_", "..", "__")
+
+// FileTemplate returns a DemuxOpener that appends to a file named
+// by replacing "{key}" in the template with the key (with any path
+// separators in the key defused), such as "/var/log/jobs/{key}.log"
+func FileTemplate(template string, f Formatter) DemuxOpener {
+	return func(key string) (Writer, error) {
+		name := strings.Replace(template, "{key}", keySanitizer.Replace(key), -1)
+		return OpenFile(name, f)
+	}
+}
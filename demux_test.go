@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// demuxSinks is a DemuxOpener that keeps track of what it opened
+type demuxSinks struct {
+	lock   sync.Mutex
+	opened map[string][]*closeRecorder
+	slow   map[string]chan struct{} // opening these waits for the channel
+}
+
+type closeRecorder struct {
+	recorder
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.lock.Lock()
+	c.closed = true
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *closeRecorder) isClosed() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.closed
+}
+
+func (s *demuxSinks) open(key string) (Writer, error) {
+	s.lock.Lock()
+	wait := s.slow[key]
+	s.lock.Unlock()
+	if wait != nil {
+		<-wait
+	}
+	if key == "bad" {
+		return nil, errors.New("cannot open")
+	}
+	w := &closeRecorder{}
+	s.lock.Lock()
+	s.opened[key] = append(s.opened[key], w)
+	s.lock.Unlock()
+	return w, nil
+}
+
+func (s *demuxSinks) get(key string) []*closeRecorder {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*closeRecorder(nil), s.opened[key]...)
+}
+
+func newDemuxSinks() *demuxSinks {
+	return &demuxSinks{
+		opened: make(map[string][]*closeRecorder),
+		slow:   make(map[string]chan struct{}),
+	}
+}
+
+func jobRecord(job, msg string) *Record {
+	rec := testRecord("m", INFO, msg)
+	if job != "" {
+		rec.Annotations = map[string]interface{}{"job": job}
+	}
+	return rec
+}
+
+func TestDemuxSplitsByKey(t *testing.T) {
+	sinks := newDemuxSinks()
+	fallback := &recorder{}
+	d := NewDemux("job", sinks.open, 0, 0)
+	d.Fallback = fallback
+
+	d.Write(jobRecord("a", "a1"), 0)
+	d.Write(jobRecord("b", "b1"), 0)
+	d.Write(jobRecord("a", "a2"), 0)
+	d.Write(jobRecord("", "none"), 0)
+	d.Write(jobRecord("bad", "unopenable"), 0)
+
+	if a := sinks.get("a"); len(a) != 1 || !sameStrings(a[0].messages(), []string{"a1", "a2"}) {
+		t.Fatalf("unexpected writers for a: %v", a)
+	}
+	if b := sinks.get("b"); len(b) != 1 || !sameStrings(b[0].messages(), []string{"b1"}) {
+		t.Fatalf("unexpected writers for b: %v", b)
+	}
+	if got := fallback.messages(); !sameStrings(got, []string{"none", "unopenable"}) {
+		t.Fatalf("fallback got %q", got)
+	}
+	keys := d.Keys()
+	sort.Strings(keys)
+	if !sameStrings(keys, []string{"a", "b"}) {
+		t.Fatalf("unexpected keys %q", keys)
+	}
+
+	d.Close()
+	if !sinks.get("a")[0].isClosed() || !sinks.get("b")[0].isClosed() {
+		t.Fatalf("Close should close the writers")
+	}
+	d.Write(jobRecord("a", "late"), 0)
+	if got := fallback.messages(); got[len(got)-1] != "late" {
+		t.Fatalf("writes after Close should go to the fallback, got %q", got)
+	}
+}
+
+func TestDemuxEvictsLeastRecentlyUsed(t *testing.T) {
+	sinks := newDemuxSinks()
+	d := NewDemux("job", sinks.open, 0, 2)
+	defer d.Close()
+
+	d.Write(jobRecord("a", "a1"), 0)
+	d.Write(jobRecord("b", "b1"), 0)
+	d.Write(jobRecord("a", "a2"), 0)
+	d.Write(jobRecord("c", "c1"), 0)
+
+	if !sinks.get("b")[0].isClosed() {
+		t.Fatalf("expected b to be evicted")
+	}
+	if sinks.get("a")[0].isClosed() {
+		t.Fatalf("did not expect a to be evicted")
+	}
+	// b comes back with a new writer
+	d.Write(jobRecord("b", "b2"), 0)
+	if b := sinks.get("b"); len(b) != 2 || !sameStrings(b[1].messages(), []string{"b2"}) {
+		t.Fatalf("expected b to be reopened, got %v", b)
+	}
+}
+
+func TestDemuxReapsIdleWriters(t *testing.T) {
+	sinks := newDemuxSinks()
+	d := NewDemux("job", sinks.open, 20*time.Millisecond, 0)
+	defer d.Close()
+
+	d.Write(jobRecord("a", "a1"), 0)
+	eventually(t, "a to be reaped", func() bool {
+		return sinks.get("a")[0].isClosed()
+	})
+	if keys := d.Keys(); len(keys) != 0 {
+		t.Fatalf("expected no open writers, got %q", keys)
+	}
+	d.Write(jobRecord("a", "a2"), 0)
+	if a := sinks.get("a"); len(a) != 2 || !sameStrings(a[1].messages(), []string{"a2"}) {
+		t.Fatalf("expected a to be reopened, got %v", a)
+	}
+}
+
+func TestDemuxTinyIdle(t *testing.T) {
+	d := NewDemux("job", newDemuxSinks().open, time.Nanosecond, 0)
+	d.Write(jobRecord("a", "a1"), 0)
+	d.Close()
+}
+
+func TestDemuxSlowOpenDoesNotBlockOtherKeys(t *testing.T) {
+	sinks := newDemuxSinks()
+	release := make(chan struct{})
+	sinks.slow["slow"] = release
+	d := NewDemux("job", sinks.open, 0, 0)
+	defer d.Close()
+
+	done := make(chan struct{})
+	go func() {
+		d.Write(jobRecord("slow", "s1"), 0)
+		close(done)
+	}()
+	// give the slow open a chance to start
+	time.Sleep(10 * time.Millisecond)
+
+	d.Write(jobRecord("fast", "f1"), 0)
+	if f := sinks.get("fast"); len(f) != 1 || !sameStrings(f[0].messages(), []string{"f1"}) {
+		t.Fatalf("unexpected writers for fast: %v", f)
+	}
+	close(release)
+	<-done
+	if s := sinks.get("slow"); len(s) != 1 || !sameStrings(s[0].messages(), []string{"s1"}) {
+		t.Fatalf("unexpected writers for slow: %v", s)
+	}
+}
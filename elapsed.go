@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// started is when the process started, as far as %{uptime} is concerned
+var started = time.Now()
+
+// A durationFormat is the compiled form of the options of the
+// elapsed time verbs, [flags][width][.precision][unit], as in
+// %{delta:+10.1ms}.  The unit is one of ns, us (or µs), ms, s, m and
+// h; without one, a unit is picked to suit the duration.  The flags
+// are '-' to align to the left and '+' to always show a sign.  Giving
+// a width keeps the column steady, so that a %{leftmargin} after it
+// stays put from one record to the next.
+type durationFormat struct {
+	pad       string // the %s format for the padding
+	sign      bool
+	precision int
+	unit      string
+}
+
+var durationOptRe = regexp.MustCompile(`^([-+]*)([0-9]*)(?:\.([0-9]+))?(ns|us|µs|ms|s|m|h)?$`)
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+func parseDurationFormat(options string) (*durationFormat, error) {
+	m := durationOptRe.FindStringSubmatch(options)
+	if m == nil {
+		return nil, fmt.Errorf("logger: invalid duration format %q", options)
+	}
+	df := &durationFormat{
+		pad:       "%s",
+		sign:      strings.Contains(m[1], "+"),
+		precision: -1,
+		unit:      m[4],
+	}
+	if m[2] != "" {
+		if strings.Contains(m[1], "-") {
+			df.pad = "%-" + m[2] + "s"
+		} else {
+			df.pad = "%" + m[2] + "s"
+		}
+	}
+	if m[3] != "" {
+		df.precision, _ = strconv.Atoi(m[3])
+	}
+	return df, nil
+}
+
+func (df *durationFormat) format(ctx *OutputContext, d time.Duration) {
+	unit := df.unit
+	if unit == "" {
+		abs := d
+		if abs < 0 {
+			abs = -abs
+		}
+		switch {
+		case abs >= time.Second:
+			unit = "s"
+		case abs >= time.Millisecond:
+			unit = "ms"
+		case abs >= time.Microsecond:
+			unit = "us"
+		default:
+			unit = "ns"
+		}
+	}
+	prec := df.precision
+	if prec < 0 {
+		prec = 3
+		if unit == "ns" {
+			prec = 0
+		}
+	}
+	num := "%.*f"
+	if df.sign {
+		num = "%+.*f"
+	}
+	str := fmt.Sprintf(num, prec, float64(d)/float64(durationUnits[unit])) + unit
+	fmt.Fprintf(ctx, df.pad, str)
+}
+
+func makeUptimeFrag(options string) (fragmentFormatter, error) {
+	df, err := parseDurationFormat(options)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx *OutputContext) {
+		df.format(ctx, ctx.src.Timestamp.Sub(started))
+	}, nil
+}
+
+// makeDeltaFrag makes a fragment that prints the time since the
+// previous record formatted by the same pattern (and hence usually
+// the same writer); the first record gets a delta of zero
+func makeDeltaFrag(options string) (fragmentFormatter, error) {
+	df, err := parseDurationFormat(options)
+	if err != nil {
+		return nil, err
+	}
+	var prev int64 // UnixNano of the previous record
+	return func(ctx *OutputContext) {
+		t := ctx.src.Timestamp.UnixNano()
+		last := atomic.SwapInt64(&prev, t)
+		if last == 0 {
+			last = t
+		}
+		df.format(ctx, time.Duration(t-last))
+	}, nil
+}
+
+// makeSinceFrag makes a fragment that prints the time since the
+// timestamp in the given annotation, which must be a time.Time; it
+// prints nothing if the record has no such annotation
+func makeSinceFrag(annot, options string) (fragmentFormatter, error) {
+	df, err := parseDurationFormat(options)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx *OutputContext) {
+		var t time.Time
+		switch v := ctx.src.Annotations[annot].(type) {
+		case time.Time:
+			t = v
+		case *time.Time:
+			if v == nil {
+				return
+			}
+			t = *v
+		default:
+			return
+		}
+		df.format(ctx, ctx.src.Timestamp.Sub(t))
+	}, nil
+}
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// A Failover writes each record to the first of its children that
+// will take it: the primary as long as it is healthy, and otherwise
+// the secondaries in order.  A child that fails is skipped until
+// RetryAfter has passed, at which point it is checked again (using
+// CheckHealth, if it is a HealthChecker, and otherwise by simply
+// trying it with the next record).  Children that are not
+// FallibleWriters are assumed never to fail.
+type Failover struct {
+	children   []*failoverChild
+	RetryAfter time.Duration
+	dropped    uint64
+}
+
+type failoverChild struct {
+	w       Writer
+	health  *childHealth
+	retryAt time.Time
+}
+
+const defaultRetryAfter = 10 * time.Second
+
+// ErrAllFailed is returned by Failover.TryWrite when none of the
+// children would take the record
+var ErrAllFailed = errors.New("all writers failed")
+
+func NewFailover(primary Writer, secondaries ...Writer) *Failover {
+	f := &Failover{
+		RetryAfter: defaultRetryAfter,
+	}
+	for _, w := range append([]Writer{primary}, secondaries...) {
+		f.children = append(f.children, &failoverChild{
+			w:      w,
+			health: newChildHealth(),
+		})
+	}
+	return f
+}
+
+// usable decides whether it's worth trying the child right now
+func (c *failoverChild) usable(now time.Time, retry time.Duration) bool {
+	c.health.lock.Lock()
+	if c.health.status.Healthy {
+		c.health.lock.Unlock()
+		return true
+	}
+	if now.Before(c.retryAt) {
+		c.health.lock.Unlock()
+		return false
+	}
+	// push out the next retry so that only one caller probes
+	c.retryAt = now.Add(retry)
+	c.health.lock.Unlock()
+
+	if hc, ok := c.w.(HealthChecker); ok {
+		if err := hc.CheckHealth(); err != nil {
+			c.health.lock.Lock()
+			c.health.status.LastError = err
+			c.health.lock.Unlock()
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Failover) TryWrite(rec *Record, skip int) error {
+	now := time.Now()
+	for _, c := range f.children {
+		if !c.usable(now, f.RetryAfter) {
+			continue
+		}
+		err := tryWrite(c.w, rec, skip+1)
+		if err != nil {
+			c.health.lock.Lock()
+			c.retryAt = now.Add(f.RetryAfter)
+			c.health.lock.Unlock()
+		}
+		c.health.result(err)
+		if err == nil {
+			return nil
+		}
+	}
+	atomic.AddUint64(&f.dropped, 1)
+	return ErrAllFailed
+}
+
+func (f *Failover) Write(rec *Record, skip int) {
+	f.TryWrite(rec, skip+1)
+}
+
+// Status reports on each child, primary first
+func (f *Failover) Status() []ChildStatus {
+	lst := make([]ChildStatus, len(f.children))
+	for i, c := range f.children {
+		lst[i] = c.health.get()
+	}
+	return lst
+}
+
+// Dropped returns the number of records that no child would take
+func (f *Failover) Dropped() uint64 {
+	return atomic.LoadUint64(&f.dropped)
+}
+
+// Close closes those children that can be closed
+func (f *Failover) Close() error {
+	var first error
+	for _, c := range f.children {
+		if cl, ok := c.w.(io.Closer); ok {
+			if err := cl.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailoverUsesSecondaryWhilePrimaryIsDown(t *testing.T) {
+	primary, secondary := &recorder{}, &recorder{}
+	f := NewFailover(primary, secondary)
+	f.RetryAfter = 20 * time.Millisecond
+
+	f.Write(testRecord("m", INFO, "one"), 0)
+	primary.setFail(errors.New("down"))
+	f.Write(testRecord("m", INFO, "two"), 0)
+	f.Write(testRecord("m", INFO, "three"), 0)
+
+	if got := primary.messages(); !sameStrings(got, []string{"one"}) {
+		t.Fatalf("primary got %q", got)
+	}
+	if got := secondary.messages(); !sameStrings(got, []string{"two", "three"}) {
+		t.Fatalf("secondary got %q", got)
+	}
+	st := f.Status()
+	if st[0].Healthy || st[0].Failed != 1 || !st[1].Healthy || st[1].Written != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// once RetryAfter has passed, the primary gets another chance
+	primary.setFail(nil)
+	time.Sleep(30 * time.Millisecond)
+	f.Write(testRecord("m", INFO, "four"), 0)
+	if got := primary.messages(); !sameStrings(got, []string{"one", "four"}) {
+		t.Fatalf("primary got %q after recovering", got)
+	}
+	if !f.Status()[0].Healthy {
+		t.Fatalf("primary should be healthy again")
+	}
+}
+
+func TestFailoverAllFailed(t *testing.T) {
+	a, b := &recorder{}, &recorder{}
+	a.setFail(errors.New("a down"))
+	b.setFail(errors.New("b down"))
+	f := NewFailover(a, b)
+	if err := f.TryWrite(testRecord("m", INFO, "lost"), 0); err != ErrAllFailed {
+		t.Fatalf("expected ErrAllFailed, got %v", err)
+	}
+	if f.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped, got %d", f.Dropped())
+	}
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"io"
+	"sync"
+)
+
+// A FanOut writes every record to all of its children, like
+// Logger.Tee, except that each child is fed from its own queue by
+// its own goroutine so that a slow child cannot hold up the others
+// (or the caller).  When a child's queue is full, records for that
+// child are dropped and counted.
+type FanOut struct {
+	children []*fanoutChild
+	wg       sync.WaitGroup
+	lock     sync.RWMutex
+	closed   bool
+}
+
+type fanoutChild struct {
+	w      Writer
+	queue  chan *Record
+	health *childHealth
+}
+
+const defaultQueueLen = 1024
+
+// NewFanOut creates a FanOut with room for queueLen records waiting
+// for each child (or a reasonable default, if queueLen is 0)
+func NewFanOut(queueLen int, children ...Writer) *FanOut {
+	if queueLen <= 0 {
+		queueLen = defaultQueueLen
+	}
+	f := &FanOut{}
+	for _, w := range children {
+		c := &fanoutChild{
+			w:      w,
+			queue:  make(chan *Record, queueLen),
+			health: newChildHealth(),
+		}
+		f.children = append(f.children, c)
+		f.wg.Add(1)
+		go f.drain(c)
+	}
+	return f
+}
+
+func (f *FanOut) drain(c *fanoutChild) {
+	defer f.wg.Done()
+	for rec := range c.queue {
+		c.health.result(tryWrite(c.w, rec, 1))
+	}
+}
+
+func (f *FanOut) Write(rec *Record, skip int) {
+	snap := rec.Snapshot(skip + 1)
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, c := range f.children {
+		if f.closed {
+			c.health.drop()
+			continue
+		}
+		select {
+		case c.queue <- snap:
+		default:
+			c.health.drop()
+		}
+	}
+}
+
+// Status reports on each child, in the order they were given
+func (f *FanOut) Status() []ChildStatus {
+	lst := make([]ChildStatus, len(f.children))
+	for i, c := range f.children {
+		lst[i] = c.health.get()
+	}
+	return lst
+}
+
+// Close waits for the queued records to be written and then closes
+// those children that can be closed
+func (f *FanOut) Close() error {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return nil
+	}
+	f.closed = true
+	for _, c := range f.children {
+		close(c.queue)
+	}
+	f.lock.Unlock()
+
+	f.wg.Wait()
+
+	var first error
+	for _, c := range f.children {
+		if cl, ok := c.w.(io.Closer); ok {
+			if err := cl.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFanOutIsolatesSlowChild(t *testing.T) {
+	slow := &recorder{block: make(chan struct{})}
+	fast := &recorder{}
+	f := NewFanOut(4, slow, fast)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		f.Write(testRecord("m", INFO, "r%d", i), 0)
+		// the fast child keeps up even though the slow one is stuck
+		eventually(t, "the fast child", func() bool {
+			return len(fast.records()) == i+1
+		})
+	}
+	st := f.Status()
+	if st[0].Dropped == 0 {
+		t.Fatalf("expected the slow child's queue to overflow, got %+v", st[0])
+	}
+	if st[1].Dropped != 0 || st[1].Written != n {
+		t.Fatalf("unexpected status for the fast child %+v", st[1])
+	}
+
+	// closing drains what the slow child had queued
+	close(slow.block)
+	f.Close()
+	got := slow.messages()
+	if uint64(len(got))+st[0].Dropped != n {
+		t.Fatalf("slow child got %d and dropped %d of %d", len(got), st[0].Dropped, n)
+	}
+	for i, msg := range got {
+		if want := fmt.Sprintf("r%d", i); msg != want {
+			t.Fatalf("slow child got %q", got)
+		}
+	}
+
+	// and writes after Close are dropped
+	f.Write(testRecord("m", INFO, "late"), 0)
+	if len(fast.records()) != n {
+		t.Fatalf("write after Close got through")
+	}
+}
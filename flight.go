@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PreTriggerKey is the annotation a FlightRecorder puts on the
+// records it releases when triggered; its value is the ID of the
+// record that did the triggering.
+const PreTriggerKey = "pretrigger"
+
+// A FlightRecorder lets records at or above a pass level (say, INFO)
+// straight through to its target, and holds on to the most recent
+// of the rest (say, DEBUG) in a bounded buffer.  When a record at or
+// above the trigger level (say, ERROR) comes along, the buffered
+// records are written out ahead of it, marked with the PreTriggerKey
+// annotation, so that the detail leading up to a failure is there
+// without having to log everything all the time.
+//
+// If Key is set, records are buffered separately according to the
+// value of that annotation (like a request ID) and a trigger only
+// releases the history with the same value.  At most MaxKeys such
+// buffers are kept; the one least recently written to is discarded
+// to make room.
+type FlightRecorder struct {
+	target  Writer
+	pass    Level
+	trigger Level
+	size    int
+	Key     string
+	MaxKeys int
+
+	lock sync.Mutex
+	bufs map[string]*flightBuffer
+}
+
+type flightBuffer struct {
+	recs []*Record
+	next int
+	full bool
+	used time.Time
+}
+
+const defaultMaxKeys = 1000
+
+func NewFlightRecorder(target Writer, pass, trigger Level, size int) *FlightRecorder {
+	return &FlightRecorder{
+		target:  target,
+		pass:    pass,
+		trigger: trigger,
+		size:    size,
+		MaxKeys: defaultMaxKeys,
+		bufs:    make(map[string]*flightBuffer),
+	}
+}
+
+func (f *FlightRecorder) key(rec *Record) string {
+	if f.Key == "" {
+		return ""
+	}
+	v, ok := rec.Annotations[f.Key]
+	if !ok {
+		return ""
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	return fmt.Sprint(v)
+}
+
+func (f *FlightRecorder) Write(rec *Record, skip int) {
+	if rec.Level <= f.trigger {
+		for _, old := range f.release(f.key(rec)) {
+			old.Annotate(PreTriggerKey, rec.ID)
+			f.target.Write(old, skip+1)
+		}
+	}
+	if rec.Level <= f.pass {
+		f.target.Write(rec, skip+1)
+		return
+	}
+	if f.size <= 0 {
+		return
+	}
+	snap := rec.Snapshot(skip + 1)
+	key := f.key(rec)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	buf, ok := f.bufs[key]
+	if !ok {
+		if f.MaxKeys > 0 && len(f.bufs) >= f.MaxKeys {
+			f.evictLocked()
+		}
+		buf = &flightBuffer{
+			recs: make([]*Record, f.size),
+		}
+		f.bufs[key] = buf
+	}
+	buf.used = time.Now()
+	buf.recs[buf.next] = snap
+	buf.next++
+	if buf.next == len(buf.recs) {
+		buf.next = 0
+		buf.full = true
+	}
+}
+
+func (f *FlightRecorder) evictLocked() {
+	var oldest string
+	var when time.Time
+	for key, buf := range f.bufs {
+		if when.IsZero() || buf.used.Before(when) {
+			oldest = key
+			when = buf.used
+		}
+	}
+	delete(f.bufs, oldest)
+}
+
+// release takes the buffered records for the key, oldest first
+func (f *FlightRecorder) release(key string) []*Record {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	buf, ok := f.bufs[key]
+	if !ok {
+		return nil
+	}
+	delete(f.bufs, key)
+	if !buf.full {
+		return buf.recs[:buf.next]
+	}
+	return append(buf.recs[buf.next:], buf.recs[:buf.next]...)
+}
+
+// Discard forgets the buffered history for the given key (such as
+// when a request completes successfully)
+func (f *FlightRecorder) Discard(key string) {
+	f.lock.Lock()
+	delete(f.bufs, key)
+	f.lock.Unlock()
+}
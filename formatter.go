@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"path"
 	"regexp"
-	"runtime"
 	"strings"
 )
 
@@ -13,25 +12,70 @@ type Formatter interface {
 	Format(*Record, bool, int) []byte
 }
 
-type outputContext struct {
+// An OutputContext is where the fragments of a pattern write the
+// record being formatted.  It keeps track of the output column so that
+// continuation lines can be indented to the left margin.
+type OutputContext struct {
 	dst        bytes.Buffer
 	src        *Record
 	stackSkip  int
 	leftMargin int
+	marginSet  bool // by SetLeftMargin
 	column     int
 	bol        bool
 }
 
-func (ctx *outputContext) WriteString(s string) (int, error) {
+// Record returns the record being formatted
+func (ctx *OutputContext) Record() *Record {
+	return ctx.src
+}
+
+// Column returns the column that the next byte of output will go in
+func (ctx *OutputContext) Column() int {
+	return ctx.column
+}
+
+// LeftMargin returns the column that continuation lines are indented to
+func (ctx *OutputContext) LeftMargin() int {
+	return ctx.leftMargin
+}
+
+// SetLeftMargin sets the column that continuation lines are indented
+// to, as %{leftmargin} does with the current column
+func (ctx *OutputContext) SetLeftMargin(column int) {
+	ctx.leftMargin = column
+	ctx.marginSet = true
+}
+
+// Caller returns the file and line that produced the record.  It
+// walks the stack if the record has no captured source, so it only
+// works when called directly from a VerbFunc.
+func (ctx *OutputContext) Caller() (file string, line int, ok bool) {
+	return ctx.src.Caller(ctx.stackSkip + 1)
+}
+
+// WriteRaw writes data that takes up no room on the screen, like a
+// terminal escape sequence, without counting it against the column
+func (ctx *OutputContext) WriteRaw(data []byte) {
+	ctx.dst.Write(data)
+}
+
+func (ctx *OutputContext) WriteString(s string) (int, error) {
 	return ctx.Write([]byte(s))
 }
 
-func (ctx *outputContext) Write(data []byte) (int, error) {
-	for _, b := range data {
-		if b == '\n' {
-			ctx.dst.WriteByte(b)
-			ctx.bol = true
-		} else {
+// Write writes the data, indenting each line after the first to the
+// left margin.  The column counts what the text takes up on the
+// screen, so multibyte and wide characters are accounted for.
+func (ctx *OutputContext) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		line := data
+		nl := bytes.IndexByte(data, '\n')
+		if nl >= 0 {
+			line = data[:nl]
+		}
+		if len(line) > 0 {
 			if ctx.bol {
 				for j := 0; j < ctx.leftMargin; j++ {
 					ctx.dst.WriteByte(' ')
@@ -39,26 +83,32 @@ func (ctx *outputContext) Write(data []byte) (int, error) {
 				ctx.column = ctx.leftMargin
 				ctx.bol = false
 			}
-			ctx.dst.WriteByte(b)
-			ctx.column++
+			ctx.dst.Write(line)
+			ctx.column += displayWidth(line)
+		}
+		if nl < 0 {
+			break
 		}
+		ctx.dst.WriteByte('\n')
+		ctx.bol = true
+		data = data[nl+1:]
 	}
-	return len(data), nil
+	return n, nil
 }
 
-type fragmentFormatter func(*outputContext)
+type fragmentFormatter func(*OutputContext)
 
 // TODO we can unfold the Write() loop by pre-scanning the literal data
 // and splitting it into lines (and special case the 1-line case, and maybe
 // even the 1 byte case)
 func literals(lit []byte) fragmentFormatter {
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		ctx.Write(lit)
 	}
 }
 
 func literal(lit string) fragmentFormatter {
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		ctx.Write([]byte(lit))
 	}
 }
@@ -81,7 +131,7 @@ func (pf *LegacyPatternFormatter) Match(rec *Record) bool {
 }
 
 func (pf *LegacyPatternFormatter) Format(r *Record, nocolor bool, skip int) []byte {
-	ctx := &outputContext{
+	ctx := &OutputContext{
 		src:       r,
 		stackSkip: skip + 1,
 	}
@@ -115,7 +165,7 @@ func PatternFormatter(pat string) (*LegacyPatternFormatter, error) {
 	}, nil
 }
 
-var formatRe *regexp.Regexp = regexp.MustCompile(`%{([a-z/]+)(?::(.*?[^\\]))?}`)
+var formatRe *regexp.Regexp = regexp.MustCompile(`%{(?:if ([^}]+)|([a-z/]+)(?::(.*?[^\\]))?(?:\|([^}]*))?)}`)
 
 func compilePattern(pat string) ([]fragmentFormatter, []fragmentFormatter, []string, error) {
 	// Find all the %{...} pieces
@@ -124,52 +174,131 @@ func compilePattern(pat string) ([]fragmentFormatter, []fragmentFormatter, []str
 		return nil, nil, nil, fmt.Errorf("logger: invalid log format: %q", pat)
 	}
 
-	var frags []fragmentFormatter
-	var nocolorFrags []fragmentFormatter
-
-	push := func(ff fragmentFormatter, iscolor bool) {
-		frags = append(frags, ff)
-		if !iscolor {
-			nocolorFrags = append(nocolorFrags, ff)
-		}
-	}
+	top := &fragmentList{}
+	list := top
+	// the %{if ...} sections we are in, innermost last
+	var open []*section
 
 	prev := 0
 	require := []string{}
+	// the annotations printed by their own verbs, which %{annots}
+	// leaves out (it is filled in as we go, but is complete by the
+	// time any record gets formatted)
+	printed := newPrintedAnnots()
 	for _, m := range matches {
 		start, end := m[0], m[1]
 		if start > prev {
-			push(literal(pat[prev:start]), false)
+			list.push(literal(pat[prev:start]), false)
 		}
-		verb := pat[m[2]:m[3]]
+		prev = end
+
+		if m[2] != -1 {
+			cond, err := compileCondition(pat[m[2]:m[3]])
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			sect := &section{cond: cond}
+			open = append(open, sect)
+			list = &sect.then
+			continue
+		}
+
+		verb := pat[m[4]:m[5]]
 		layout := ""
-		if m[4] != -1 {
-			layout = pat[m[4]:m[5]]
+		if m[6] != -1 {
+			layout = pat[m[6]:m[7]]
 		}
+		var mod *modifier
+		if m[8] != -1 {
+			var err error
+			mod, err = parseModifiers(pat[m[8]:m[9]])
+			if err != nil {
+				if m[6] == -1 {
+					return nil, nil, nil, err
+				}
+				// not modifiers after all, just a '|' in the options
+				layout = pat[m[6]:m[9]]
+				mod = nil
+			}
+		}
+
+		switch verb {
+		case "else":
+			if len(open) == 0 || open[len(open)-1].inElse {
+				return nil, nil, nil, fmt.Errorf("logger: unexpected %%{else} in %q", pat)
+			}
+			sect := open[len(open)-1]
+			sect.inElse = true
+			list = &sect.otherwise
+			continue
+		case "end":
+			if len(open) == 0 {
+				return nil, nil, nil, fmt.Errorf("logger: unexpected %%{end} in %q", pat)
+			}
+			sect := open[len(open)-1]
+			open = open[:len(open)-1]
+			list = top
+			if len(open) > 0 {
+				list = &open[len(open)-1].then
+				if open[len(open)-1].inElse {
+					list = &open[len(open)-1].otherwise
+				}
+			}
+			sect.push(list)
+			continue
+		}
+
 		var frag fragmentFormatter
 		var err error
+		iscolor := false
 
 		if strings.HasPrefix(verb, "annot/") {
 			annot := verb[6:]
 			frag = makeAnnotFrag(annot, layout)
-			require = append(require, annot)
+			// only annotations that are always printed are
+			// required for the pattern to match
+			if len(open) == 0 {
+				require = append(require, annot)
+			}
+			printed.add(annot, open)
+		} else if strings.HasPrefix(verb, "since/") {
+			frag, err = makeSinceFrag(verb[6:], layout)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			printed.add(verb[6:], open)
+		} else if verb == "annots" {
+			frag, err = makeAnnotsFrag(layout, printed)
+			if err != nil {
+				return nil, nil, nil, err
+			}
 		} else {
-			fragMaker, ok := verbTable[verb]
+			var maker fragMaker
+			var ok bool
+			maker, iscolor, ok = lookupVerb(verb)
 			if !ok {
 				return nil, nil, nil, fmt.Errorf("logger: unknown verb %q in %q", verb, pat)
 			}
-			frag, err = fragMaker(layout)
+			frag, err = maker(layout)
 			if err != nil {
 				return nil, nil, nil, err
 			}
+			if frag == nil {
+				return nil, nil, nil, fmt.Errorf("logger: verb %q produced no output function", verb)
+			}
 		}
-		push(frag, colorTable[verb])
-		prev = end
+		if mod != nil {
+			frag = mod.wrap(frag)
+		}
+		list.push(frag, iscolor)
+	}
+	if len(open) > 0 {
+		return nil, nil, nil, fmt.Errorf("logger: missing %%{end} in %q", pat)
 	}
 	if prev < len(pat) {
-		push(literal(pat[prev:]), false)
+		top.push(literal(pat[prev:]), false)
 	}
-	return frags, nocolorFrags, require, nil
+	return top.frags, top.nocolor, require, nil
 }
 
 type fragMaker func(string) (fragmentFormatter, error)
@@ -189,6 +318,16 @@ var verbTable = map[string]fragMaker{
 	"level":      makeLevelFrag,
 	"id":         makeIdFrag,
 	"leftmargin": makeLeftMarginFrag,
+	"longfile":   makeLongFileFrag,
+	"func":       makeFuncFrag,
+	"longfunc":   makeLongFuncFrag,
+	"package":    makePackageFrag,
+	"pid":        makePidFrag,
+	"program":    makeProgramFrag,
+	"hostname":   makeHostnameFrag,
+	"goroutine":  makeGoroutineFrag,
+	"uptime":     makeUptimeFrag,
+	"delta":      makeDeltaFrag,
 }
 
 func stringopt(options string) string {
@@ -200,14 +339,14 @@ func stringopt(options string) string {
 }
 
 func makeLeftMarginFrag(_ string) (fragmentFormatter, error) {
-	return func(ctx *outputContext) {
-		ctx.leftMargin = ctx.column
+	return func(ctx *OutputContext) {
+		ctx.SetLeftMargin(ctx.column)
 	}, nil
 }
 
 func makeModuleFrag(options string) (fragmentFormatter, error) {
 	options = stringopt(options)
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		fmt.Fprintf(ctx, options, ctx.src.Module)
 	}, nil
 }
@@ -219,7 +358,7 @@ func makeIdFrag(options string) (fragmentFormatter, error) {
 		options = "%" + options
 	}
 
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		fmt.Fprintf(ctx, options, ctx.src.ID)
 	}, nil
 }
@@ -233,15 +372,8 @@ func makeShortFileFrag(options string) (fragmentFormatter, error) {
 	if options == "" {
 		options = "%[1]s:%[2]d"
 	}
-	return func(ctx *outputContext) {
-		if src, ok := ctx.src.Annotations["source"]; ok {
-			if sourcer, ok := src.(Sourcer); ok {
-				fmt.Fprintf(ctx, options, path.Base(sourcer.File()), sourcer.Line())
-				return
-			}
-		}
-
-		_, file, line, ok := runtime.Caller(ctx.stackSkip)
+	return func(ctx *OutputContext) {
+		file, line, ok := ctx.src.Caller(ctx.stackSkip)
 		if !ok {
 			file = "???"
 			line = 0
@@ -254,36 +386,18 @@ func makeShortFileFrag(options string) (fragmentFormatter, error) {
 
 func makeLevelFrag(options string) (fragmentFormatter, error) {
 	options = stringopt(options)
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		fmt.Fprintf(ctx, options, levelNames[ctx.src.Level])
 	}, nil
 }
 
-/*
-func makeFrag(verb, extra string) (fragmentFormatter, error) {
-	switch verb {
-	case "time":
-		return makeTimeFrag(extra)
-	case "level":
-		return makeLevelFrag(extra)
-	case "id":
-		return makeIdFrag(extra)
-	case "pid":
-	case "program":
-	case "module":
-	case "message":
-	case "longfile":
-	case "shortfile":
-	case "color":
-*/
-
 const rfc3339Milli = "2006-01-02T15:04:05.999Z07:00"
 
 func makeTimeFrag(options string) (fragmentFormatter, error) {
 	if options == "" {
 		options = rfc3339Milli
 	}
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		ctx.WriteString(ctx.src.Timestamp.Format(options))
 	}, nil
 
@@ -295,7 +409,7 @@ func makeMessageFrag(options string) (fragmentFormatter, error) {
 	} else {
 		options = "%" + options
 	}
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		str := fmt.Sprintf(ctx.src.Format, ctx.src.Args...)
 		fmt.Fprintf(ctx, options, str)
 	}, nil
@@ -307,7 +421,7 @@ func makeAnnotFrag(annot, options string) fragmentFormatter {
 	// it's basically equivalent to using ".0s" but more efficient and
 	// easier to understand
 	if options == "-" {
-		return func(ctx *outputContext) {}
+		return func(ctx *OutputContext) {}
 	}
 
 	if options == "" {
@@ -316,7 +430,7 @@ func makeAnnotFrag(annot, options string) fragmentFormatter {
 		options = "%" + options
 	}
 
-	return func(ctx *outputContext) {
+	return func(ctx *OutputContext) {
 		if value, ok := ctx.src.Annotations[annot]; ok {
 			fmt.Fprintf(ctx, options, value)
 		}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// A HealthChecker is a writer that can check on its destination
+// without having to write a record to it.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// ChildStatus reports on the health of one of the writers behind a
+// combinator like Failover or FanOut
+type ChildStatus struct {
+	Healthy   bool
+	Since     time.Time // when Healthy last changed
+	Written   uint64
+	Failed    uint64
+	Dropped   uint64
+	LastError error
+}
+
+type childHealth struct {
+	lock   sync.Mutex
+	status ChildStatus
+}
+
+func newChildHealth() *childHealth {
+	return &childHealth{
+		status: ChildStatus{
+			Healthy: true,
+			Since:   time.Now(),
+		},
+	}
+}
+
+func (h *childHealth) result(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err == nil {
+		h.status.Written++
+	} else {
+		h.status.Failed++
+		h.status.LastError = err
+	}
+	h.setHealthyLocked(err == nil)
+}
+
+func (h *childHealth) setHealthyLocked(ok bool) {
+	if h.status.Healthy != ok {
+		h.status.Healthy = ok
+		h.status.Since = time.Now()
+	}
+}
+
+func (h *childHealth) drop() {
+	h.lock.Lock()
+	h.status.Dropped++
+	h.lock.Unlock()
+}
+
+func (h *childHealth) get() ChildStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.status
+}
+
+// tryWrite writes to w, finding out whether it worked if w is able
+// to tell us
+func tryWrite(w Writer, rec *Record, skip int) error {
+	if fw, ok := w.(FallibleWriter); ok {
+		return fw.TryWrite(rec, skip+1)
+	}
+	w.Write(rec, skip+1)
+	return nil
+}
@@ -2,52 +2,150 @@ package logging
 
 import (
 	"path"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Module names form a hierarchy by way of dots, so that "db.pool"
+// and "db.pool.conn" are both beneath "db", and a pattern that
+// matches a module also matches everything beneath it.
+
+// globMatch reports whether the module matches the given glob
+// pattern, falling back to exact matching if the pattern is malformed
+func globMatch(pattern, module string) bool {
+	match, err := path.Match(pattern, module)
+	if err != nil {
+		return pattern == module
+	}
+	return match
+}
+
+// matchModule reports whether the pattern matches the module or one
+// of its ancestors
+func matchModule(pattern, module string) bool {
+	_, ok := specificity(pattern, module)
+	return ok
+}
+
+// specificity reports whether the pattern matches the module (or
+// one of its ancestors) and if so, how specific a match it is.  The
+// longer the literal prefix of the pattern, the more specific it is,
+// with a pattern that has no wildcards at all beating a glob with
+// the same prefix.
+func specificity(pattern, module string) (int, bool) {
+	for m := module; ; {
+		if globMatch(pattern, m) {
+			break
+		}
+		dot := strings.LastIndexByte(m, '.')
+		if dot < 0 {
+			return 0, false
+		}
+		m = m[:dot]
+	}
+	if wild := strings.IndexAny(pattern, "*?[\\"); wild >= 0 {
+		return 2 * wild, true
+	}
+	return 2*len(pattern) + 1, true
+}
+
+// mostSpecific returns the index of the most specific of n patterns
+// that matches the module (the first one, in case of a tie), or -1
+// if none of them do
+func mostSpecific(n int, pattern func(int) string, module string) int {
+	best, bestScore := -1, -1
+	for i := 0; i < n; i++ {
+		score, ok := specificity(pattern(i), module)
+		if ok && score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
 type levelRule struct {
 	pattern string
 	level   Level
 }
 
 type LevelFilter struct {
-	rules  []levelRule
-	target Writer
+	rules     []levelRule
+	overrides []*levelOverride
+	annots    annotRules
+	target    Writer
 	// cache:
 	lock      sync.Mutex
 	threshold map[string]Level
+	seen      map[string]struct{}
+
+	limits rateLimits
+	// ReportEvery is how often the counts of records dropped by
+	// rate limits are reported
+	ReportEvery time.Duration
 }
 
 func MustFilter(w Writer) *LevelFilter {
 	return &LevelFilter{
-		target: w,
+		target:      w,
+		threshold:   make(map[string]Level),
+		ReportEvery: defaultReportEvery,
 	}
 }
 
 func (f *LevelFilter) Write(rec *Record, skip int) {
-	if rec.Level <= f.GetLevel(rec.Module) {
+	level := f.level(rec.Module)
+	if f.annots.active() {
+		level = f.annots.level(rec, level)
+	}
+	if rec.Level > level {
+		return
+	}
+	if f.limit(rec) {
+		f.markSeen(rec.Module)
 		f.target.Write(rec, skip+1)
 	}
 }
 
 // GetLevel returns the log level for the given module.
 func (f *LevelFilter) GetLevel(module string) Level {
+	return f.level(module)
+}
+
+// markSeen notes a module as one the filter has written records from
+func (f *LevelFilter) markSeen(module string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.seen[module]; !ok {
+		if f.seen == nil {
+			f.seen = make(map[string]struct{})
+		}
+		f.seen[module] = struct{}{}
+	}
+}
+
+// level looks up the level for a module
+func (f *LevelFilter) level(module string) Level {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 	if level, ok := f.threshold[module]; ok {
 		return level
 	}
 	level := DEBUG // default value in case of no match
-	for _, r := range f.rules {
-		match, err := path.Match(r.pattern, module)
-		if err != nil {
-			// fall back to exact matching
-			match = r.pattern == module
-		}
-		if match {
-			level = r.level
-			break
-		}
+	// temporary overrides take precedence over the rules
+	if i := mostSpecific(len(f.overrides), func(i int) string {
+		return f.overrides[i].Module
+	}, module); i >= 0 {
+		level = f.overrides[i].Level
+		f.threshold[module] = level
+		return level
+	}
+	i := mostSpecific(len(f.rules), func(i int) string {
+		return f.rules[i].pattern
+	}, module)
+	if i >= 0 {
+		level = f.rules[i].level
 	}
 	// cache the result for later
 	f.threshold[module] = level
@@ -58,7 +156,11 @@ func (f *LevelFilter) GetLevel(module string) Level {
 // module contains one of the special characters '*' or '?',
 // then it is interpreted as a glob (unless `path.Match` rejects
 // the pattern as being malformed, in which case an error is logged
-// and the module is considered an exact match)
+// and the module is considered an exact match).  The level also
+// applies to the modules beneath it (so setting "db" covers
+// "db.pool.conn") unless there is a more specific rule for them;
+// when several rules apply, the one with the longest literal prefix
+// wins.
 func (f *LevelFilter) SetLevel(level Level, module string) {
 	// add the rule
 	f.lock.Lock()
@@ -77,3 +179,37 @@ func (f *LevelFilter) SetLevel(level Level, module string) {
 	f.rules = append(f.rules, levelRule{module, level})
 
 }
+
+// Rules returns the rules set by SetLevel, in the order they were set
+func (f *LevelFilter) Rules() []LevelSetting {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	lst := make([]LevelSetting, len(f.rules))
+	for i, r := range f.rules {
+		lst[i] = LevelSetting{r.pattern, r.level}
+	}
+	return lst
+}
+
+// SetRules replaces all the rules set by SetLevel
+func (f *LevelFilter) SetRules(lst []LevelSetting) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.threshold = make(map[string]Level)
+	f.rules = f.rules[:0]
+	for _, s := range lst {
+		f.rules = append(f.rules, levelRule{s.Module, s.Level})
+	}
+}
+
+// Modules returns the modules the filter has written records from
+func (f *LevelFilter) Modules() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	lst := make([]string, 0, len(f.seen))
+	for module := range f.seen {
+		lst = append(lst, module)
+	}
+	sort.Strings(lst)
+	return lst
+}
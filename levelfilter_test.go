@@ -0,0 +1,15 @@
+package logging
+
+import "testing"
+
+func TestLevelFilterModulesSeen(t *testing.T) {
+	f := MustFilter(&recorder{})
+	f.SetLevel(INFO, "*")
+
+	f.GetLevel("ghost")
+	f.Write(testRecord("quiet", DEBUG, "filtered out"), 0)
+	f.Write(testRecord("real", INFO, "written"), 0)
+	if m := f.Modules(); !sameStrings(m, []string{"real"}) {
+		t.Fatalf("expected only the module that was written, got %q", m)
+	}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LevelEnv is the environment variable holding a level spec that is
+// applied by ApplyEnv
+const LevelEnv = "LOGGING_LEVEL"
+
+// A LevelSetting is one entry in a level spec
+type LevelSetting struct {
+	Module string `json:"module"`
+	Level  Level  `json:"level"`
+}
+
+// ParseLevelSpec parses a comma-separated list of module=level
+// settings, such as "*=info,db.*=debug,http=warning".  Modules are
+// patterns as in LevelFilter.SetLevel, and levels are as for
+// ParseLevel.  A level on its own is short for "*=level".
+func ParseLevelSpec(spec string) ([]LevelSetting, error) {
+	var lst []LevelSetting
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, level := "*", item
+		if eq := strings.IndexByte(item, '='); eq >= 0 {
+			module = strings.TrimSpace(item[:eq])
+			level = item[eq+1:]
+			if module == "" {
+				return nil, fmt.Errorf("logger: missing module in %q", item)
+			}
+		}
+		l, err := ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		lst = append(lst, LevelSetting{module, l})
+	}
+	return lst, nil
+}
+
+// ApplySpec parses a level spec (see ParseLevelSpec) and, if it is
+// valid, sets the levels it calls for
+func (f *LevelFilter) ApplySpec(spec string) error {
+	lst, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	for _, s := range lst {
+		f.SetLevel(s.Level, s.Module)
+	}
+	return nil
+}
+
+// ApplyEnv applies the level spec in the LOGGING_LEVEL environment
+// variable, if there is one
+func (f *LevelFilter) ApplyEnv() error {
+	spec, ok := os.LookupEnv(LevelEnv)
+	if !ok {
+		return nil
+	}
+	if err := f.ApplySpec(spec); err != nil {
+		return fmt.Errorf("%s: %w", LevelEnv, err)
+	}
+	return nil
+}
+
+// Spec returns the filter's rules as a level spec
+func (f *LevelFilter) Spec() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	items := make([]string, len(f.rules))
+	for i, r := range f.rules {
+		items[i] = r.pattern + "=" + strings.ToLower(r.level.String())
+	}
+	return strings.Join(items, ",")
+}
+
+// Flag returns a flag.Value that applies level specs to the filter,
+// for use like:
+//
+//	flag.Var(pretty.Writer.Flag(), "log-level", "log levels (like *=info,db=debug)")
+func (f *LevelFilter) Flag() flag.Value {
+	return levelFlag{f}
+}
+
+type levelFlag struct {
+	filter *LevelFilter
+}
+
+func (lf levelFlag) String() string {
+	if lf.filter == nil {
+		return ""
+	}
+	return lf.filter.Spec()
+}
+
+func (lf levelFlag) Set(spec string) error {
+	return lf.filter.ApplySpec(spec)
+}
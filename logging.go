@@ -10,12 +10,19 @@ type Logger struct {
 	annot   map[string]interface{}
 	module  string
 	outputs []Writer
+	reg     *moduleEntry
 }
 
+// New and Sub are kept from being inlined, because an inlined call
+// initializing a package-level variable gets an <autogenerated>
+// position, which would leave register with nothing to go on
+//
+//go:noinline
 func New(module string) *Logger {
 	return &Logger{
 		module:  module,
 		outputs: []Writer{DefaultBackend},
+		reg:     register(module, 1),
 	}
 }
 
@@ -23,6 +30,7 @@ func (l *Logger) To(wr ...Writer) *Logger {
 	return &Logger{
 		module:  l.module,
 		outputs: wr,
+		reg:     l.reg,
 	}
 }
 
@@ -33,6 +41,22 @@ func (l *Logger) Tee(wr Writer) *Logger {
 	return &Logger{
 		module:  l.module,
 		outputs: o,
+		reg:     l.reg,
+	}
+}
+
+// Sub returns a logger for the child module "parent.name", which
+// shares this logger's annotations and outputs.  Level rules set on
+// the parent module apply to the child unless overridden.
+//
+//go:noinline
+func (l *Logger) Sub(name string) *Logger {
+	module := l.module + "." + name
+	return &Logger{
+		module:  module,
+		annot:   l.annot,
+		outputs: l.outputs,
+		reg:     register(module, 1),
 	}
 }
 
@@ -95,6 +119,9 @@ func (l *Logger) dispatch(format string, args []interface{}, v Level, s int) {
 		Format:      format,
 		Args:        args,
 	}
+	if l.reg != nil {
+		atomic.AddUint64(&l.reg.records, 1)
+	}
 	for _, wr := range l.outputs {
 		wr.Write(rec, s+1)
 	}
@@ -118,6 +145,7 @@ func (l *Logger) InRe(ctx context.Context) *Logger {
 		module:  l.module,
 		annot:   c.annot,
 		outputs: c.outputs,
+		reg:     l.reg,
 	}
 }
 
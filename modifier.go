@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A modifier reshapes the output of a verb to fit a column.  The
+// modifiers come after a '|' at the end of a verb, separated by
+// commas, as in %{module|max=12,abbrev,width=12} or
+// %{shortfile:%s|max=20,left}:
+//
+//	max=N     cut the output down to N columns, dropping the end
+//	left      ...dropping the beginning instead
+//	middle    ...dropping the middle instead, marked with '…'
+//	abbrev    shorten the leading components of a dotted name to
+//	          their first letter (as many as needed to fit max, or
+//	          all of them without one), so db.pool.conn is d.p.conn
+//	width=N   pad the output out to N columns
+//	right     ...aligning it to the right
+//
+// Widths are counted in columns on the screen, not bytes, so that
+// the column (and hence %{leftmargin}) comes out right.  Only the
+// first line of the output is reshaped.  If what follows the '|'
+// isn't a list of modifiers, it is taken to be part of the verb's
+// options, so %{time:15|04} is still a time format.
+type modifier struct {
+	max    int
+	cut    string // "right", "left" or "middle"
+	abbrev bool
+	width  int
+	right  bool
+}
+
+const ellipsis = "…"
+
+func parseModifiers(spec string) (*modifier, error) {
+	mod := &modifier{cut: "right"}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		key, value := item, ""
+		if eq := strings.IndexByte(item, '='); eq >= 0 {
+			key, value = item[:eq], item[eq+1:]
+		}
+		var err error
+		switch key {
+		case "max":
+			mod.max, err = strconv.Atoi(value)
+			if err == nil && mod.max <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "width":
+			mod.width, err = strconv.Atoi(value)
+			if err == nil && mod.width <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "left", "middle":
+			mod.cut = key
+		case "abbrev":
+			mod.abbrev = true
+		case "right":
+			mod.right = true
+		default:
+			return nil, fmt.Errorf("logger: unknown modifier %q", item)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("logger: invalid modifier %q: %s", item, err)
+		}
+		if value != "" && key != "max" && key != "width" {
+			return nil, fmt.Errorf("logger: invalid modifier %q", item)
+		}
+	}
+	return mod, nil
+}
+
+// wrap returns a fragment that captures what frag writes and then
+// reshapes it
+func (mod *modifier) wrap(frag fragmentFormatter) fragmentFormatter {
+	return func(ctx *OutputContext) {
+		// the captured lines aren't indented; ctx does that when
+		// they are written out
+		sub := &OutputContext{
+			src:       ctx.src,
+			stackSkip: ctx.stackSkip + 1,
+			column:    ctx.column,
+		}
+		frag(sub)
+		out := sub.dst.String()
+		rest := ""
+		if nl := strings.IndexByte(out, '\n'); nl >= 0 {
+			out, rest = out[:nl], out[nl:]
+		}
+		ctx.WriteString(mod.apply(out))
+		if sub.marginSet {
+			ctx.SetLeftMargin(sub.leftMargin)
+		}
+		ctx.WriteString(rest)
+	}
+}
+
+func (mod *modifier) apply(s string) string {
+	if mod.abbrev {
+		s = abbreviate(s, mod.max)
+	}
+	w := stringWidth(s)
+	if mod.max > 0 && w > mod.max {
+		switch mod.cut {
+		case "left":
+			s = keepRight(s, mod.max)
+		case "middle":
+			room := mod.max - stringWidth(ellipsis)
+			s = keepLeft(s, room-room/2) + ellipsis + keepRight(s, room/2)
+		default:
+			s = keepLeft(s, mod.max)
+		}
+		w = stringWidth(s)
+	}
+	if w < mod.width {
+		pad := strings.Repeat(" ", mod.width-w)
+		if mod.right {
+			return pad + s
+		}
+		return s + pad
+	}
+	return s
+}
+
+// keepLeft returns as much of the start of s as fits in n columns
+func keepLeft(s string, n int) string {
+	w := 0
+	for i, r := range s {
+		w += runeWidth(r)
+		if w > n {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// keepRight returns as much of the end of s as fits in n columns
+func keepRight(s string, n int) string {
+	runes := []rune(s)
+	w := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		w += runeWidth(runes[i])
+		if w > n {
+			return string(runes[i+1:])
+		}
+	}
+	return s
+}
+
+// abbreviate shortens the components of a dotted name, from the
+// left, to their first letter until it fits in max columns (or all
+// but the last of them if max is 0)
+func abbreviate(s string, max int) string {
+	parts := strings.Split(s, ".")
+	for i := 0; i < len(parts)-1; i++ {
+		if max > 0 && stringWidth(strings.Join(parts, ".")) <= max {
+			break
+		}
+		for _, r := range parts[i] {
+			parts[i] = string(r)
+			break
+		}
+	}
+	return strings.Join(parts, ".")
+}
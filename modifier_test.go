@@ -0,0 +1,59 @@
+package logging
+
+import "testing"
+
+func TestModifiers(t *testing.T) {
+	rec := &Record{Module: "database.pool.conn", Level: INFO, Format: "héllo 世界"}
+	for pat, want := range map[string]string{
+		"[%{module|max=9}]":                 "[database.]",
+		"[%{module|max=8,left}]":            "[ool.conn]",
+		"[%{module|max=9,middle}]":          "[data…conn]",
+		"[%{module|abbrev}]":                "[d.p.conn]",
+		"[%{module|abbrev,max=12}]":         "[d.pool.conn]",
+		"[%{module|abbrev,width=12,right}]": "[    d.p.conn]",
+		"[%{level:.4s|width=6}]":            "[INFO  ]",
+		"%{module:-20s|max=10}|":            "database.p|",
+		"[%{message|max=8}]":                "[héllo 世]",
+		"[%{message|max=7}]":                "[héllo ]",
+		"[%{message|width=12}]":             "[héllo 世界  ]",
+	} {
+		if got := formatPlain(t, pat, rec); got != want {
+			t.Errorf("%s: expected %q, got %q", pat, want, got)
+		}
+	}
+	for _, pat := range []string{
+		"%{module|bogus}",
+		"%{module|max=x}",
+		"%{module|max=0}",
+		"%{module|width=-1}",
+		"%{module|right=3}",
+	} {
+		if _, err := PatternFormatter(pat); err == nil {
+			t.Errorf("expected %q to be rejected", pat)
+		}
+	}
+}
+
+func TestModifiersOrOptions(t *testing.T) {
+	// not a list of modifiers, so it's part of the time format
+	got := formatPlain(t, "%{time:15|04}", &Record{})
+	if len(got) != 5 || got[2] != '|' {
+		t.Fatalf("expected a time like 12|34, got %q", got)
+	}
+}
+
+func TestModifiersAndLeftMargin(t *testing.T) {
+	rec := &Record{Level: INFO, Format: "a\nb\nc"}
+	for pat, want := range map[string]string{
+		// only the first line is reshaped, and the rest are
+		// indented once
+		"%{level} %{leftmargin}%{message|width=5}": "INFO a    \n     b\n     c",
+		"%{level} %{leftmargin}%{message|max=1}":   "INFO a\n     b\n     c",
+		// and without a margin, not at all
+		"%{level} %{message|width=3}": "INFO a  \nb\nc",
+	} {
+		if got := formatPlain(t, pat, rec); got != want {
+			t.Errorf("%s: expected %q, got %q", pat, want, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// A NetWriter sends formatted records to a network endpoint, dialing
+// (and redialing after a failure) as needed.  Records are formatted
+// without color.  Since the far end can go away, this is usually
+// wrapped in a Spool.
+type NetWriter struct {
+	network string
+	address string
+	format  Formatter
+	Timeout time.Duration
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+const defaultNetTimeout = 5 * time.Second
+
+func NewNetWriter(network, address string, f Formatter) *NetWriter {
+	return &NetWriter{
+		network: network,
+		address: address,
+		format:  f,
+		Timeout: defaultNetTimeout,
+	}
+}
+
+func (n *NetWriter) TryWrite(rec *Record, skip int) error {
+	buf := n.format.Format(rec, true, skip+1)
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.conn == nil {
+		conn, err := net.DialTimeout(n.network, n.address, n.Timeout)
+		if err != nil {
+			return err
+		}
+		n.conn = conn
+	}
+	if n.Timeout > 0 {
+		n.conn.SetWriteDeadline(time.Now().Add(n.Timeout))
+	}
+	_, err := n.conn.Write(buf)
+	if err != nil {
+		// drop the connection; we'll redial next time
+		n.conn.Close()
+		n.conn = nil
+	}
+	return err
+}
+
+func (n *NetWriter) Write(rec *Record, skip int) {
+	n.TryWrite(rec, skip+1)
+}
+
+func (n *NetWriter) Close() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// CheckHealth makes sure we can connect to the far end
+func (n *NetWriter) CheckHealth() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout(n.network, n.address, n.Timeout)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	return nil
+}
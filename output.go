@@ -4,12 +4,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sync"
 )
 
 type Writer interface {
 	Write(*Record, int)
 }
 
+// A FallibleWriter is a Writer that can report failure to deliver a
+// record, which is what lets it be wrapped by something (like a
+// Spool) that does something about it.
+type FallibleWriter interface {
+	Writer
+	TryWrite(*Record, int) error
+}
+
 type TextWriter struct {
 	dest    io.Writer
 	format  Formatter
@@ -46,6 +56,43 @@ func (t *TextWriter) Write(rec *Record, skip int) {
 	t.dest.Write(t.format.Format(rec, t.NoColor, skip+1))
 }
 
+// A FileWriter is a TextWriter that owns the file it is writing to.
+// Coloring is off by default.
+type FileWriter struct {
+	TextWriter
+	file  *os.File
+	close sync.Once
+	err   error
+}
+
+// OpenFile opens the named file for appending, creating it (and its
+// directory) if necessary.
+func OpenFile(name string, f Formatter) (*FileWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriter{
+		TextWriter: TextWriter{
+			dest:    file,
+			format:  f,
+			NoColor: true,
+		},
+		file: file,
+	}, nil
+}
+
+// Close closes the file; it is safe to call more than once
+func (w *FileWriter) Close() error {
+	w.close.Do(func() {
+		w.err = w.file.Close()
+	})
+	return w.err
+}
+
 type Stdout struct{}
 
 func (std Stdout) Write(rec *Record, skip int) {
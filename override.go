@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"sort"
+	"time"
+)
+
+// internalModule is the module for records about the logging system
+// itself
+const internalModule = "logging"
+
+// A LevelOverride is a temporary level for a module pattern, which
+// takes precedence over the rules set by SetLevel until it expires
+type LevelOverride struct {
+	Module  string    `json:"module"`
+	Level   Level     `json:"level"`
+	Expires time.Time `json:"expires"`
+}
+
+type levelOverride struct {
+	LevelOverride
+	timer *time.Timer
+}
+
+// Override sets the level for the given module (a pattern, as in
+// SetLevel) for the given length of time, after which the filter
+// reverts to its usual rules.  An existing override for the same
+// pattern is replaced.  A NOTICE record is written to the filter's
+// target when an override starts and when it ends.
+func (f *LevelFilter) Override(level Level, module string, ttl time.Duration) {
+	f.addOverride(level, module, ttl)
+	f.target.Write(synthesize(internalModule, NOTICE,
+		"level override %s=%s for %s", module, level, ttl), 1)
+}
+
+// AdoptOverrides moves the overrides in effect on another filter over
+// to this one, as when a filter is replaced by a new configuration.
+// They carry on (and expire) here, without any records about it.
+func (f *LevelFilter) AdoptOverrides(from *LevelFilter) {
+	if from == f {
+		return
+	}
+	from.lock.Lock()
+	lst := from.overrides
+	from.overrides = nil
+	from.threshold = make(map[string]Level)
+	from.lock.Unlock()
+
+	for _, o := range lst {
+		o.timer.Stop()
+		if ttl := time.Until(o.Expires); ttl > 0 {
+			f.addOverride(o.Level, o.Module, ttl)
+		}
+	}
+}
+
+func (f *LevelFilter) addOverride(level Level, module string, ttl time.Duration) {
+	o := &levelOverride{
+		LevelOverride: LevelOverride{
+			Module:  module,
+			Level:   level,
+			Expires: time.Now().Add(ttl),
+		},
+	}
+
+	f.lock.Lock()
+	for i, old := range f.overrides {
+		if old.Module == module {
+			old.timer.Stop()
+			f.overrides = append(f.overrides[:i], f.overrides[i+1:]...)
+			break
+		}
+	}
+	f.overrides = append(f.overrides, o)
+	f.threshold = make(map[string]Level)
+	o.timer = time.AfterFunc(ttl, func() {
+		if f.removeOverride(o) {
+			f.target.Write(synthesize(internalModule, NOTICE,
+				"level override %s=%s expired", module, level), 1)
+		}
+	})
+	f.lock.Unlock()
+}
+
+// CancelOverride ends the override for the given module pattern
+// early, returning false if there wasn't one
+func (f *LevelFilter) CancelOverride(module string) bool {
+	f.lock.Lock()
+	var o *levelOverride
+	for _, old := range f.overrides {
+		if old.Module == module {
+			o = old
+			break
+		}
+	}
+	f.lock.Unlock()
+	if o == nil || !f.removeOverride(o) {
+		return false
+	}
+	o.timer.Stop()
+	f.target.Write(synthesize(internalModule, NOTICE,
+		"level override %s=%s cancelled", o.Module, o.Level), 1)
+	return true
+}
+
+func (f *LevelFilter) removeOverride(o *levelOverride) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i, old := range f.overrides {
+		if old == o {
+			f.overrides = append(f.overrides[:i], f.overrides[i+1:]...)
+			f.threshold = make(map[string]Level)
+			return true
+		}
+	}
+	return false
+}
+
+// Overrides returns the overrides in effect, soonest to expire first
+func (f *LevelFilter) Overrides() []LevelOverride {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	lst := make([]LevelOverride, len(f.overrides))
+	for i, o := range f.overrides {
+		lst[i] = o.LevelOverride
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].Expires.Before(lst[j].Expires)
+	})
+	return lst
+}
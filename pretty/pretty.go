@@ -4,6 +4,7 @@
 package pretty
 
 import (
+	"fmt"
 	"os"
 	
 	"github.com/dkolbly/logging"
@@ -16,6 +17,9 @@ var Writer = logging.MustFilter(TextWriter)
 func init() {
 	tty := isatty.IsTerminal(os.Stdout.Fd())
 	Writer.SetLevel(logging.INFO, "*")
+	if err := Writer.ApplyEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "pretty: %s\n", err)
+	}
 	TextWriter.NoColor = !tty
 	logging.DefaultBackend.Target = Writer
 }
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	pid     = os.Getpid()
+	program = filepath.Base(os.Args[0])
+)
+
+func makePidFrag(options string) (fragmentFormatter, error) {
+	if options == "" {
+		options = "%d"
+	} else {
+		options = "%" + options
+	}
+	return func(ctx *OutputContext) {
+		fmt.Fprintf(ctx, options, pid)
+	}, nil
+}
+
+func makeProgramFrag(options string) (fragmentFormatter, error) {
+	options = stringopt(options)
+	return func(ctx *OutputContext) {
+		fmt.Fprintf(ctx, options, program)
+	}, nil
+}
+
+// the hostname is looked up when the pattern is compiled, not for
+// every record
+func makeHostnameFrag(options string) (fragmentFormatter, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "???"
+	}
+	options = stringopt(options)
+	return func(ctx *OutputContext) {
+		fmt.Fprintf(ctx, options, host)
+	}, nil
+}
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateLimitedKey is the annotation on the report records from a
+// rate-limited LevelFilter, giving the number of records dropped
+const RateLimitedKey = "ratelimited"
+
+// A RateLimit caps the rate of records from a module with a token
+// bucket that refills at Rate records per second and holds up to
+// Burst of them (a Burst less than 1 counts as 1).  If Exempt is
+// set, records at least as severe as it are never held back (and
+// don't use up tokens).
+type RateLimit struct {
+	Rate   float64
+	Burst  int
+	Exempt *Level
+}
+
+type rateRule struct {
+	pattern string
+	limit   RateLimit
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+type rateLimits struct {
+	lock    sync.Mutex
+	rules   []rateRule
+	buckets map[string]*tokenBucket // nil entries for unlimited modules
+	dropped map[string]uint64       // since the last report
+	report  *time.Timer             // running while there are drops to report
+}
+
+const defaultReportEvery = time.Minute
+
+// SetRateLimit limits the rate of records from the given module,
+// which is matched the same way as in SetLevel (so every module
+// matching a pattern gets its own bucket).  A limit with a Rate of
+// zero removes the rule for that module.  The counts of records
+// dropped so far are still reported.
+func (f *LevelFilter) SetRateLimit(limit RateLimit, module string) {
+	rl := &f.limits
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	rl.buckets = make(map[string]*tokenBucket)
+	for i, rule := range rl.rules {
+		if rule.pattern == module {
+			if limit.Rate <= 0 {
+				rl.rules = append(rl.rules[:i], rl.rules[i+1:]...)
+			} else {
+				rl.rules[i].limit = limit
+			}
+			return
+		}
+	}
+	if limit.Rate > 0 {
+		rl.rules = append(rl.rules, rateRule{module, limit})
+	}
+}
+
+func (rl *rateLimits) bucketLocked(module string, now time.Time) *tokenBucket {
+	if b, ok := rl.buckets[module]; ok {
+		return b
+	}
+	var b *tokenBucket
+	i := mostSpecific(len(rl.rules), func(i int) string {
+		return rl.rules[i].pattern
+	}, module)
+	if i >= 0 {
+		limit := rl.rules[i].limit
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+		b = &tokenBucket{
+			limit:  limit,
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+	}
+	rl.buckets[module] = b
+	return b
+}
+
+// limit decides whether the record gets past the rate limits
+func (f *LevelFilter) limit(rec *Record) bool {
+	rl := &f.limits
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if len(rl.rules) == 0 {
+		return true
+	}
+
+	now := time.Now()
+	b := rl.bucketLocked(rec.Module, now)
+	if b == nil || (b.limit.Exempt != nil && rec.Level <= *b.limit.Exempt) {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	if rl.dropped == nil {
+		rl.dropped = make(map[string]uint64)
+	}
+	rl.dropped[rec.Module]++
+	if rl.report == nil {
+		// the counts go out ReportEvery from the first drop, whether
+		// or not anything else gets logged by then
+		rl.report = time.AfterFunc(f.ReportEvery, func() {
+			f.FlushRateLimits()
+		})
+	}
+	return false
+}
+
+// FlushRateLimits reports the counts of records dropped by the rate
+// limits right away, rather than waiting for ReportEvery to pass
+func (f *LevelFilter) FlushRateLimits() {
+	rl := &f.limits
+	rl.lock.Lock()
+	if rl.report != nil {
+		rl.report.Stop()
+		rl.report = nil
+	}
+	var reports []*Record
+	for module, n := range rl.dropped {
+		r := synthesize(module, WARNING, "rate limit dropped %d records", n)
+		r.Annotate(RateLimitedKey, n)
+		reports = append(reports, r)
+	}
+	rl.dropped = nil
+	rl.lock.Unlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Module < reports[j].Module
+	})
+	for _, r := range reports {
+		f.target.Write(r, 1)
+	}
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	r := &recorder{}
+	f := MustFilter(r)
+	f.ReportEvery = time.Hour
+	exempt := ERROR
+	f.SetRateLimit(RateLimit{Rate: 0.001, Burst: 2, Exempt: &exempt}, "chat*")
+	f.SetRateLimit(RateLimit{Rate: 0.001}, "quiet")
+
+	for i := 0; i < 5; i++ {
+		f.Write(testRecord("chatty", INFO, "c%d", i), 0)
+		f.Write(testRecord("quiet", INFO, "q%d", i), 0)
+	}
+	f.Write(testRecord("chatty", ERROR, "exempt"), 0)
+	// with no Exempt level, nothing gets through for free
+	f.Write(testRecord("quiet", EMERGENCY, "limited"), 0)
+	f.FlushRateLimits()
+
+	want := []string{
+		"c0", "q0", "c1", "exempt",
+		"rate limit dropped 3 records",
+		"rate limit dropped 5 records",
+	}
+	if got := r.messages(); !sameStrings(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	recs := r.records()
+	if rec := recs[4]; rec.Module != "chatty" || rec.Annotations[RateLimitedKey] != uint64(3) {
+		t.Fatalf("unexpected report %+v", rec)
+	}
+}
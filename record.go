@@ -3,7 +3,9 @@ package logging
 import (
 	"encoding/json"
 	"fmt"
-	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,11 +29,27 @@ type formattedRecord struct {
 		Args        []interface{}          `json:"args"`
 		Annotations map[string]interface{} `json:"annotations,omitempty"`
 	*/
+	// the level stays a number here, even though a Level marshals
+	// as its name
+	Level   int    `json:"level"`
 	Message string `json:"message"`
 	File    string `json:"file"`
 	Line    int    `json:"line"`
 }
 
+// synthesize creates a record on behalf of the logging system itself,
+// such as a report on records that were held back or dropped
+func synthesize(module string, level Level, format string, args ...interface{}) *Record {
+	return &Record{
+		ID:        atomic.AddUint64(&seq, 1),
+		Module:    module,
+		Level:     level,
+		Timestamp: time.Now(),
+		Format:    format,
+		Args:      args,
+	}
+}
+
 func (r *Record) JSON(skip int) ([]byte, error) {
 	fr := &formattedRecord{
 		Record: *r,
@@ -44,9 +62,10 @@ func (r *Record) JSON(skip int) ([]byte, error) {
 			Args:        r.Args,
 			Annotations: r.Annotations,
 		*/
+		Level:   int(r.Level),
 		Message: fmt.Sprintf(r.Format, r.Args...),
 	}
-	_, file, line, ok := runtime.Caller(skip)
+	file, line, ok := r.Caller(skip)
 	if ok {
 		fr.File = file
 		fr.Line = line
@@ -95,3 +114,33 @@ var levelNames = [8]string{
 func (p Level) String() string {
 	return levelNames[p]
 }
+
+// ParseLevel parses the name of a level, in any case, or its number
+func ParseLevel(s string) (Level, error) {
+	s = strings.TrimSpace(s)
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil && n < uint64(len(levelNames)) {
+		return Level(n), nil
+	}
+	return 0, fmt.Errorf("logger: invalid level %q", s)
+}
+
+func (p Level) MarshalText() ([]byte, error) {
+	if int(p) >= len(levelNames) {
+		return nil, fmt.Errorf("logger: invalid level %d", p)
+	}
+	return []byte(levelNames[p]), nil
+}
+
+func (p *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*p = level
+	return nil
+}
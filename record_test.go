@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRecordJSONLevelIsNumeric(t *testing.T) {
+	buf, err := testRecord("m", ERROR, "hello %s", "world").JSON(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["level"] != float64(ERROR) || got["message"] != "hello world" {
+		t.Fatalf("unexpected JSON %s", buf)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	buf, err := json.Marshal(map[string]Level{"level": WARNING})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"level":"WARNING"}` {
+		t.Fatalf("unexpected JSON %s", buf)
+	}
+	var level Level
+	if err := level.UnmarshalText([]byte("debug")); err != nil || level != DEBUG {
+		t.Fatalf("expected DEBUG, got %v (%v)", level, err)
+	}
+	if err := level.UnmarshalText([]byte("LOUD")); err == nil {
+		t.Fatalf("expected an error for an invalid level")
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ModuleInfo describes a module that loggers have been created for,
+// with the places they were created (by New or Sub) and the number of
+// records logged through them
+type ModuleInfo struct {
+	Module  string   `json:"module"`
+	Created []string `json:"created"`
+	Records uint64   `json:"records"`
+}
+
+type moduleEntry struct {
+	module  string
+	records uint64
+	sites   []string
+}
+
+// maxSites limits how many creation sites are remembered per module
+const maxSites = 16
+
+var registry struct {
+	lock    sync.Mutex
+	modules map[string]*moduleEntry
+}
+
+// register notes the creation of a logger for the module by the
+// code skip frames up
+func register(module string, skip int) *moduleEntry {
+	// go through the frames rather than use runtime.Caller, so that
+	// inlined callers are accounted for
+	site := "???"
+	pcs := make([]uintptr, skip+8)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if i == skip {
+			if frame.File != "" {
+				site = fmt.Sprintf("%s:%d", path.Base(frame.File), frame.Line)
+			}
+			break
+		}
+		if !more {
+			break
+		}
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if registry.modules == nil {
+		registry.modules = make(map[string]*moduleEntry)
+	}
+	e, ok := registry.modules[module]
+	if !ok {
+		e = &moduleEntry{module: module}
+		registry.modules[module] = e
+	}
+	for _, s := range e.sites {
+		if s == site {
+			return e
+		}
+	}
+	if len(e.sites) < maxSites {
+		e.sites = append(e.sites, site)
+	}
+	return e
+}
+
+func (e *moduleEntry) info() ModuleInfo {
+	return ModuleInfo{
+		Module:  e.module,
+		Created: append([]string(nil), e.sites...),
+		Records: atomic.LoadUint64(&e.records),
+	}
+}
+
+// Modules returns every module that a logger has been created for,
+// in order by name
+func Modules() []ModuleInfo {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	lst := make([]ModuleInfo, 0, len(registry.modules))
+	for _, e := range registry.modules {
+		lst = append(lst, e.info())
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].Module < lst[j].Module
+	})
+	return lst
+}
+
+// LookupModule returns what is known about the given module
+func LookupModule(module string) (ModuleInfo, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	e, ok := registry.modules[module]
+	if !ok {
+		return ModuleInfo{}, false
+	}
+	return e.info(), true
+}
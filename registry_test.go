@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+var registryTestLog = New("registry.pkgvar")
+
+var registryTestSub = registryTestLog.Sub("sub")
+
+func TestRegistryCreationSites(t *testing.T) {
+	_ = registryTestSub
+	New("registry.local")
+
+	sites := map[string][]string{}
+	for _, info := range Modules() {
+		sites[info.Module] = info.Created
+	}
+	for _, module := range []string{"registry.pkgvar", "registry.pkgvar.sub", "registry.local"} {
+		created := sites[module]
+		if len(created) != 1 || !strings.HasPrefix(created[0], "registry_test.go:") {
+			t.Errorf("expected %s to be created in registry_test.go, got %q", module, created)
+		}
+	}
+}
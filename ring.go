@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Ring keeps the most recent records written to it in memory, where
+// they can be looked at (and new ones watched for) while the process
+// is running.  Records are stored as snapshots (see Record.Snapshot),
+// complete with their call site; those handed out by Recent or a
+// Subscription are shared and must not be modified.
+type Ring struct {
+	lock sync.Mutex
+	buf  []*Record
+	next int
+	full bool
+	subs map[*Subscription]struct{}
+}
+
+// A Query picks out records held by a Ring.  Since and Until, when
+// set, bound the record timestamps (inclusively), and Limit, when
+// set, keeps only that many of the most recent matches.
+type Query struct {
+	Selector
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (q *Query) Match(rec *Record) bool {
+	if !q.Since.IsZero() && rec.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && rec.Timestamp.After(q.Until) {
+		return false
+	}
+	return q.Selector.Match(rec)
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{
+		buf:  make([]*Record, size),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (r *Ring) Write(rec *Record, skip int) {
+	snap := rec.Snapshot(skip + 1)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.buf) > 0 {
+		r.buf[r.next] = snap
+		r.next++
+		if r.next == len(r.buf) {
+			r.next = 0
+			r.full = true
+		}
+	}
+	for sub := range r.subs {
+		if !sub.query.Match(snap) {
+			continue
+		}
+		select {
+		case sub.ch <- snap:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Len returns the number of records currently held
+func (r *Ring) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.full {
+		return len(r.buf)
+	}
+	return r.next
+}
+
+// Recent returns the records matching the query, oldest first
+func (r *Ring) Recent(q Query) []*Record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var lst []*Record
+	// walk backwards from the newest so that we can stop at the limit
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+	for i := 1; i <= n; i++ {
+		rec := r.buf[(r.next-i+len(r.buf))%len(r.buf)]
+		if !q.Match(rec) {
+			continue
+		}
+		lst = append(lst, rec)
+		if q.Limit > 0 && len(lst) == q.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(lst)-1; i < j; i, j = i+1, j-1 {
+		lst[i], lst[j] = lst[j], lst[i]
+	}
+	return lst
+}
+
+// A Subscription delivers records matching its query as they are
+// written to a Ring.  Records that arrive while the channel is full
+// are dropped (and counted) rather than holding up the writer.  The
+// time bounds and Limit of the query don't apply to a subscription.
+type Subscription struct {
+	C       <-chan *Record
+	ch      chan *Record
+	ring    *Ring
+	query   Query
+	dropped uint64
+}
+
+// Subscribe starts watching for new records matching the query, with
+// room for buffer of them to be waiting on the channel
+func (r *Ring) Subscribe(q Query, buffer int) *Subscription {
+	q.Since = time.Time{}
+	q.Until = time.Time{}
+	ch := make(chan *Record, buffer)
+	sub := &Subscription{
+		C:     ch,
+		ch:    ch,
+		ring:  r,
+		query: q,
+	}
+	r.lock.Lock()
+	r.subs[sub] = struct{}{}
+	r.lock.Unlock()
+	return sub
+}
+
+// Dropped returns the number of records that didn't fit in the channel
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Cancel stops the subscription and closes its channel
+func (s *Subscription) Cancel() {
+	s.ring.lock.Lock()
+	defer s.ring.lock.Unlock()
+	if _, ok := s.ring.subs[s]; ok {
+		delete(s.ring.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,43 @@
+package logging
+
+// A Route sends the records picked out by its Selector to a Target.
+// If Stop is set, a record taken by this route is not considered by
+// any later ones.
+type Route struct {
+	Selector
+	Target Writer
+	Stop   bool
+}
+
+// A Router checks each record against its routes in order, writing
+// it to the target of every route that matches up to and including
+// the first matching route that says to Stop.  Records that match no
+// route at all go to the Fallback, if there is one.
+type Router struct {
+	routes   []Route
+	Fallback Writer
+}
+
+func NewRouter(routes ...Route) *Router {
+	return &Router{
+		routes: routes,
+	}
+}
+
+func (r *Router) Write(rec *Record, skip int) {
+	matched := false
+	for i := range r.routes {
+		route := &r.routes[i]
+		if !route.Match(rec) {
+			continue
+		}
+		matched = true
+		route.Target.Write(rec, skip+1)
+		if route.Stop {
+			break
+		}
+	}
+	if !matched && r.Fallback != nil {
+		r.Fallback.Write(rec, skip+1)
+	}
+}
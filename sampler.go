@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SampledKey is the annotation on the report records from a Sampler,
+// giving the number of records that were sampled away
+const SampledKey = "sampled"
+
+// A Sampler keeps a tight loop from flooding the log.  Records are
+// grouped by module and (unformatted) message template, and in each
+// tick only the first few records in a group are let through,
+// followed by every Mth one after that.  At the end of each tick,
+// a report record (at ReportLevel, and carrying the SampledKey
+// annotation) goes out for each group that had records sampled away.
+// Close stops the ticker, writing out the reports for the last tick.
+type Sampler struct {
+	target      Writer
+	tick        time.Duration
+	first       uint64
+	thereafter  uint64
+	ReportLevel Level
+
+	lock  sync.Mutex
+	count map[sampleKey]*sampleCount
+
+	close sync.Once
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+type sampleKey struct {
+	module string
+	format string
+}
+
+type sampleCount struct {
+	seen    uint64
+	dropped uint64
+}
+
+// NewSampler creates a sampler that passes the first records in each
+// tick, and every thereafter'th one after that (or none, if
+// thereafter is 0).  A tick of 0 means one second.
+func NewSampler(target Writer, tick time.Duration, first, thereafter int) *Sampler {
+	if tick <= 0 {
+		tick = time.Second
+	}
+	s := &Sampler{
+		target:      target,
+		tick:        tick,
+		first:       uint64(first),
+		thereafter:  uint64(thereafter),
+		ReportLevel: NOTICE,
+		count:       make(map[sampleKey]*sampleCount),
+		done:        make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.ticker()
+	return s
+}
+
+func (s *Sampler) ticker() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Sampler) Write(rec *Record, skip int) {
+	key := sampleKey{rec.Module, rec.Format}
+
+	s.lock.Lock()
+	c, ok := s.count[key]
+	if !ok {
+		c = &sampleCount{}
+		s.count[key] = c
+	}
+	c.seen++
+	pass := c.seen <= s.first
+	if !pass && s.thereafter > 0 {
+		pass = (c.seen-s.first)%s.thereafter == 0
+	}
+	if !pass {
+		c.dropped++
+	}
+	s.lock.Unlock()
+
+	if pass {
+		s.target.Write(rec, skip+1)
+	}
+}
+
+// resetLocked starts a new tick, returning the reports on the old one
+func (s *Sampler) resetLocked() []*Record {
+	var keys []sampleKey
+	for key, c := range s.count {
+		if c.dropped > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].module != keys[j].module {
+			return keys[i].module < keys[j].module
+		}
+		return keys[i].format < keys[j].format
+	})
+	reports := make([]*Record, len(keys))
+	for i, key := range keys {
+		c := s.count[key]
+		r := synthesize(key.module, s.ReportLevel,
+			"sampled away %d of %d records like %q",
+			c.dropped, c.seen, key.format)
+		r.Annotate(SampledKey, c.dropped)
+		reports[i] = r
+	}
+	s.count = make(map[sampleKey]*sampleCount)
+	return reports
+}
+
+// Flush ends the current tick early, writing out any reports
+func (s *Sampler) Flush() {
+	s.lock.Lock()
+	reports := s.resetLocked()
+	s.lock.Unlock()
+	for _, r := range reports {
+		s.target.Write(r, 1)
+	}
+}
+
+// Close stops the ticker and writes out the reports on the current tick
+func (s *Sampler) Close() error {
+	s.close.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		s.Flush()
+	})
+	return nil
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplerPassesFirstAndEveryMth(t *testing.T) {
+	r := &recorder{}
+	s := NewSampler(r, time.Hour, 2, 3)
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		s.Write(testRecord("m", WARNING, "retry %d", i), 0)
+	}
+	want := []string{"retry 0", "retry 1", "retry 4", "retry 7"}
+	if got := r.messages(); !sameStrings(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// a new tick starts the counts over
+	s.Flush()
+	s.Write(testRecord("m", WARNING, "retry %d", 10), 0)
+	if got := r.messages(); got[len(got)-1] != "retry 10" {
+		t.Fatalf("expected the count to start over, got %q", got)
+	}
+}
+
+func TestSamplerReports(t *testing.T) {
+	r := &recorder{}
+	s := NewSampler(r, time.Hour, 1, 0)
+
+	for i := 0; i < 3; i++ {
+		s.Write(testRecord("m", INFO, "retry %d", i), 0)
+		s.Write(testRecord("m", INFO, "again %d", i), 0)
+		s.Write(testRecord("b", INFO, "other %d", i), 0)
+	}
+	s.Write(testRecord("z", INFO, "once"), 0)
+	s.Flush()
+
+	recs := r.records()
+	if len(recs) != 4+3 {
+		t.Fatalf("expected 4 records and 3 reports, got %q", r.messages())
+	}
+	want := []string{
+		`sampled away 2 of 3 records like "other %d"`,
+		`sampled away 2 of 3 records like "again %d"`,
+		`sampled away 2 of 3 records like "retry %d"`,
+	}
+	if got := r.messages()[4:]; !sameStrings(got, want) {
+		t.Fatalf("expected reports %q, got %q", want, got)
+	}
+	for _, rec := range recs[4:] {
+		if rec.Level != NOTICE || rec.Annotations[SampledKey] != uint64(2) {
+			t.Fatalf("unexpected report %+v", rec)
+		}
+	}
+
+	// Close reports on the last tick, and nothing is repeated
+	s.Write(testRecord("m", INFO, "retry %d", 3), 0)
+	s.Write(testRecord("m", INFO, "retry %d", 4), 0)
+	s.Close()
+	s.Close()
+	got := r.messages()[7:]
+	if !sameStrings(got, []string{"retry 3", `sampled away 1 of 2 records like "retry %d"`}) {
+		t.Fatalf("unexpected records at Close: %q", got)
+	}
+}
+
+func TestSamplerTicks(t *testing.T) {
+	r := &recorder{}
+	s := NewSampler(r, 10*time.Millisecond, 1, 0)
+	defer s.Close()
+
+	s.Write(testRecord("m", INFO, "x"), 0)
+	s.Write(testRecord("m", INFO, "x"), 0)
+	eventually(t, "a report", func() bool {
+		return len(r.records()) == 2
+	})
+}
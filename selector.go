@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"fmt"
+	"path"
+)
+
+// A LevelRange is an inclusive range of levels, from the most severe
+// (numerically smallest) to the least severe
+type LevelRange struct {
+	Most  Level
+	Least Level
+}
+
+// Levels returns the range of levels between from and to, in either order
+func Levels(from, to Level) *LevelRange {
+	if from > to {
+		from, to = to, from
+	}
+	return &LevelRange{from, to}
+}
+
+// AtLeast returns the range of levels at least as severe as the given one
+func AtLeast(level Level) *LevelRange {
+	return &LevelRange{EMERGENCY, level}
+}
+
+func (r *LevelRange) Contains(level Level) bool {
+	return level >= r.Most && level <= r.Least
+}
+
+// An AnnotMatch matches records that carry the annotation Key.  If
+// Values is not empty, the annotation must also (in its fmt.Sprint
+// form) be one of them, and if Glob is not empty, it must match that
+// pattern (as with path.Match).
+type AnnotMatch struct {
+	Key    string
+	Values []string
+	Glob   string
+}
+
+func (m *AnnotMatch) Match(rec *Record) bool {
+	v, ok := rec.Annotations[m.Key]
+	if !ok {
+		return false
+	}
+	if len(m.Values) == 0 && m.Glob == "" {
+		return true
+	}
+	str, ok := v.(string)
+	if !ok {
+		str = fmt.Sprint(v)
+	}
+	if m.Glob != "" {
+		if match, _ := path.Match(m.Glob, str); !match {
+			return false
+		}
+	}
+	if len(m.Values) == 0 {
+		return true
+	}
+	for _, want := range m.Values {
+		if str == want {
+			return true
+		}
+	}
+	return false
+}
+
+// A Selector picks out records by module, level and annotations.
+// The zero Selector matches everything.
+type Selector struct {
+	Module string      // glob as in LevelFilter.SetLevel; "" matches any
+	Levels *LevelRange // nil matches any
+	Annots []AnnotMatch
+}
+
+func (s *Selector) Match(rec *Record) bool {
+	if s.Module != "" && !matchModule(s.Module, rec.Module) {
+		return false
+	}
+	if s.Levels != nil && !s.Levels.Contains(rec.Level) {
+		return false
+	}
+	for i := range s.Annots {
+		if !s.Annots[i].Match(rec) {
+			return false
+		}
+	}
+	return true
+}
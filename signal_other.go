@@ -0,0 +1,12 @@
+//go:build !unix
+
+package logging
+
+import (
+	"time"
+)
+
+// CycleOnSignals does nothing on systems without SIGUSR1 and SIGUSR2
+func (f *LevelFilter) CycleOnSignals(reset time.Duration) (stop func()) {
+	return func() {}
+}
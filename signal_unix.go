@@ -0,0 +1,100 @@
+//go:build unix
+
+package logging
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CycleOnSignals lets the verbosity of the filter's default ("*")
+// rule be changed from outside the process: SIGUSR1 raises it one
+// step (from INFO to DEBUG, say) and SIGUSR2 lowers it one step.
+// Each change is logged at NOTICE.  If reset is not zero, the level
+// goes back to what it was to begin with once that long has passed
+// since the last change.  The returned function stops listening for
+// the signals (and may be called more than once).
+func (f *LevelFilter) CycleOnSignals(reset time.Duration) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+
+	initial := f.defaultLevel()
+	set := func(level Level, why string) {
+		old := f.defaultLevel()
+		if old == level {
+			return
+		}
+		f.SetLevel(level, "*")
+		f.target.Write(synthesize(internalModule, NOTICE,
+			"level *=%s (was %s) on %s", level, old, why), 1)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// the reset timer is only touched here, so that it can't race
+		// with the signals
+		var timer *time.Timer
+		var expired <-chan time.Time
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			case <-expired:
+				expired = nil
+				set(initial, "timeout")
+			case sig := <-ch:
+				level := f.defaultLevel()
+				if sig == syscall.SIGUSR1 {
+					if level < DEBUG {
+						level++
+					}
+					set(level, "SIGUSR1")
+				} else {
+					if level > EMERGENCY {
+						level--
+					}
+					set(level, "SIGUSR2")
+				}
+
+				if reset > 0 {
+					if timer != nil {
+						timer.Stop()
+					}
+					timer = time.NewTimer(reset)
+					expired = timer.C
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// defaultLevel returns the level set for "*", which is DEBUG if
+// there isn't one
+func (f *LevelFilter) defaultLevel() Level {
+	for _, r := range f.Rules() {
+		if r.Module == "*" {
+			return r.Level
+		}
+	}
+	return DEBUG
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package logging
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCycleOnSignals(t *testing.T) {
+	r := &recorder{}
+	f := MustFilter(r)
+	f.SetLevel(INFO, "*")
+	stop := f.CycleOnSignals(100 * time.Millisecond)
+	defer stop()
+
+	signal := func(sig syscall.Signal, want Level) {
+		t.Helper()
+		syscall.Kill(syscall.Getpid(), sig)
+		eventually(t, "level "+want.String(), func() bool {
+			return f.GetLevel("x") == want
+		})
+	}
+	signal(syscall.SIGUSR1, DEBUG)
+	signal(syscall.SIGUSR2, INFO)
+	signal(syscall.SIGUSR2, NOTICE)
+
+	// and back to where it started once things are quiet
+	eventually(t, "the reset", func() bool {
+		return f.GetLevel("x") == INFO
+	})
+	want := []string{
+		"level *=DEBUG (was INFO) on SIGUSR1",
+		"level *=INFO (was DEBUG) on SIGUSR2",
+		"level *=NOTICE (was INFO) on SIGUSR2",
+		"level *=INFO (was NOTICE) on timeout",
+	}
+	eventually(t, "the notices", func() bool {
+		return len(r.records()) == len(want)
+	})
+	if got := r.messages(); !sameStrings(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	stop()
+	stop()
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// SourceKey is the annotation under which a record carries its
+// captured call site.
+const SourceKey = "source"
+
+// A Source is a captured call site.  Records that outlive the call
+// to Write (because they are queued, spooled or buffered somewhere)
+// carry one under the "source" annotation, so that formatters which
+// would otherwise walk the stack still report where they came from.
+type Source struct {
+	Path      string `json:"file"`
+	Lineno    int    `json:"line"`
+	Function  string `json:"func,omitempty"`
+	Goroutine int64  `json:"goroutine,omitempty"`
+}
+
+func (s *Source) File() string {
+	return s.Path
+}
+
+func (s *Source) Line() int {
+	return s.Lineno
+}
+
+// wantGoroutine is set once a pattern uses %{goroutine}; until then,
+// captured sources don't pay for finding out the goroutine
+var wantGoroutine int32
+
+func captureSource(skip int) *Source {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return nil
+	}
+	src := &Source{
+		Path:   file,
+		Lineno: line,
+	}
+	if atomic.LoadInt32(&wantGoroutine) != 0 {
+		src.Goroutine = goroutineID()
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		src.Function = fn.Name()
+	}
+	return src
+}
+
+// Caller returns the file and line that produced the record.  A
+// captured "source" annotation takes precedence; otherwise, like
+// runtime.Caller, it walks up skip frames from the point of the call.
+func (r *Record) Caller(skip int) (file string, line int, ok bool) {
+	if src, ok := r.Annotations[SourceKey].(Sourcer); ok {
+		return src.File(), src.Line(), true
+	}
+	_, file, line, ok = runtime.Caller(skip + 1)
+	return
+}
+
+// callSite is like Caller but also finds the (fully qualified) name
+// of the function, which is "" if the captured source doesn't know it
+func (r *Record) callSite(skip int) (file string, line int, function string, ok bool) {
+	switch src := r.Annotations[SourceKey].(type) {
+	case *Source:
+		return src.Path, src.Lineno, src.Function, true
+	case Sourcer:
+		return src.File(), src.Line(), "", true
+	}
+	var pc uintptr
+	pc, file, line, ok = runtime.Caller(skip + 1)
+	if ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			function = fn.Name()
+		}
+	}
+	return
+}
+
+// goroutine returns the ID of the goroutine that produced the record,
+// which (absent a captured source) is assumed to be the current one.
+// It is 0 if the source was captured without it.
+func (r *Record) goroutine() int64 {
+	switch src := r.Annotations[SourceKey].(type) {
+	case *Source:
+		return src.Goroutine
+	case Sourcer:
+		return 0
+	}
+	return goroutineID()
+}
+
+// goroutineID digs the current goroutine's ID out of the header of
+// its stack trace, "goroutine 123 [running]:"
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// Snapshot returns a copy of the record that is safe to hold on to
+// after Write returns.  The copy has its own annotation map and
+// carries the call site found skip frames up (if it did not already
+// have one) as its "source" annotation.
+func (r *Record) Snapshot(skip int) *Record {
+	c := *r
+	c.Annotations = grow(r.Annotations)
+	if _, ok := c.Annotations[SourceKey].(Sourcer); !ok {
+		if src := captureSource(skip); src != nil {
+			c.Annotations[SourceKey] = src
+		}
+	}
+	if r.Args != nil {
+		c.Args = make([]interface{}, len(r.Args))
+		copy(c.Args, r.Args)
+	}
+	return &c
+}
@@ -0,0 +1,547 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Spool sits in front of a FallibleWriter (typically a NetWriter)
+// and keeps records from being lost while the target is failing.
+// As long as the target is healthy, records pass straight through.
+// Once a write fails, that record and every one after it are
+// appended to a segmented write-ahead log in a local directory, and
+// a background goroutine replays them to the target, in order, as
+// soon as it accepts writes again.
+//
+// Fully delivered segments are deleted and the position within the
+// oldest segment is recorded in a cursor file, so a spool reopened
+// on the same directory after a restart picks up where it left off
+// without redelivering anything.  When the spool outgrows its disk
+// budget, the oldest segments are evicted.
+//
+// Spooled records are replayed with their message already formatted
+// (Format "%s" and the message as the only argument) and their call
+// site in the "source" annotation; annotations that can't be
+// represented in JSON are replaced by their fmt.Sprint form.
+type Spool struct {
+	dir    string
+	target FallibleWriter
+	cfg    SpoolConfig
+
+	lock    sync.Mutex
+	segs    []*spoolSegment // oldest first; the last one is appended to
+	active  *os.File
+	nextSeq uint64
+	size    int64
+	readSeq uint64
+	readOff int64
+	reader  *os.File
+	dropped uint64
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SpoolConfig controls the shape of a spool; zero values select the
+// defaults.
+type SpoolConfig struct {
+	SegmentSize   int64         // bytes per segment file (1MB)
+	MaxBytes      int64         // total disk budget (64MB)
+	RetryInterval time.Duration // time between delivery attempts (1s)
+}
+
+// SpoolStats describes the current backlog of a spool
+type SpoolStats struct {
+	Segments int
+	Bytes    int64
+	Pending  int
+	Dropped  uint64
+}
+
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	records int // not yet delivered
+}
+
+type spoolEntry struct {
+	ID          uint64                 `json:"id"`
+	Module      string                 `json:"module"`
+	Level       int                    `json:"level"`
+	Timestamp   time.Time              `json:"ts"`
+	Message     string                 `json:"msg"`
+	Annotations map[string]interface{} `json:"annot,omitempty"`
+	Source      *Source                `json:"src,omitempty"`
+}
+
+const (
+	spoolSuffix = ".seg"
+	cursorFile  = "cursor"
+
+	defaultSegmentSize   = 1 << 20
+	defaultSpoolMax      = 64 << 20
+	defaultRetryInterval = time.Second
+)
+
+// NewSpool opens (creating if necessary) a spool in the given
+// directory in front of the given target.  If the directory holds
+// undelivered records from a previous run, replay of those starts
+// right away.
+func NewSpool(dir string, target FallibleWriter, cfg SpoolConfig) (*Spool, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultSegmentSize
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSpoolMax
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:     dir,
+		target:  target,
+		cfg:     cfg,
+		nextSeq: 1,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.replay()
+	return s, nil
+}
+
+func (s *Spool) segPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", seq, spoolSuffix))
+}
+
+// recover picks up the segments and cursor left behind by a
+// previous run
+func (s *Spool) recover() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolSuffix))
+	if err != nil {
+		return err
+	}
+	var seqs []uint64
+	for _, name := range names {
+		base := strings.TrimSuffix(filepath.Base(name), spoolSuffix)
+		seq, err := strconv.ParseUint(base, 16, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	curSeq, curOff := s.readCursor()
+
+	for _, seq := range seqs {
+		if seq < curSeq {
+			// delivered, but we went down before deleting it
+			os.Remove(s.segPath(seq))
+			continue
+		}
+		off := int64(0)
+		if seq == curSeq {
+			off = curOff
+		}
+		size, count, err := countRecords(s.segPath(seq), off)
+		if err != nil {
+			return err
+		}
+		s.segs = append(s.segs, &spoolSegment{
+			seq:     seq,
+			size:    size,
+			records: count,
+		})
+		s.size += size
+		s.nextSeq = seq + 1
+	}
+	if len(s.segs) > 0 {
+		s.readSeq = s.segs[0].seq
+		if s.readSeq == curSeq {
+			s.readOff = curOff
+		}
+	}
+	// note that we never append to a segment left over from a
+	// previous run, in case it ends with a partial record
+	return nil
+}
+
+func countRecords(file string, off int64) (int64, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	count := 0
+	buf := bufio.NewReader(f)
+	for {
+		_, err := buf.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		count++
+	}
+	return info.Size(), count, nil
+}
+
+func (s *Spool) readCursor() (uint64, int64) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seq uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(buf), "%x %d", &seq, &off); err != nil {
+		return 0, 0
+	}
+	return seq, off
+}
+
+func (s *Spool) saveCursorLocked() {
+	file := filepath.Join(s.dir, cursorFile)
+	tmp := file + ".tmp"
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%016x %d\n", s.readSeq, s.readOff)), 0644)
+	if err == nil {
+		os.Rename(tmp, file)
+	}
+}
+
+func (s *Spool) Write(rec *Record, skip int) {
+	s.lock.Lock()
+	if len(s.segs) == 0 && !s.closed {
+		s.lock.Unlock()
+		if s.target.TryWrite(rec, skip+1) == nil {
+			return
+		}
+		s.lock.Lock()
+	}
+	defer s.lock.Unlock()
+	s.appendLocked(rec.Snapshot(skip + 1))
+}
+
+func encodeSpoolEntry(rec *Record) []byte {
+	e := &spoolEntry{
+		ID:        rec.ID,
+		Module:    rec.Module,
+		Level:     int(rec.Level),
+		Timestamp: rec.Timestamp,
+		Message:   fmt.Sprintf(rec.Format, rec.Args...),
+	}
+	switch src := rec.Annotations[SourceKey].(type) {
+	case *Source:
+		e.Source = src
+	case Sourcer:
+		e.Source = &Source{
+			Path:   src.File(),
+			Lineno: src.Line(),
+		}
+	}
+	for k, v := range rec.Annotations {
+		if k == SourceKey {
+			continue
+		}
+		if e.Annotations == nil {
+			e.Annotations = make(map[string]interface{}, len(rec.Annotations))
+		}
+		if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+		e.Annotations[k] = v
+	}
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	return append(buf, '\n')
+}
+
+func (e *spoolEntry) record() *Record {
+	rec := &Record{
+		ID:          e.ID,
+		Module:      e.Module,
+		Level:       Level(e.Level),
+		Timestamp:   e.Timestamp,
+		Format:      "%s",
+		Args:        []interface{}{e.Message},
+		Annotations: e.Annotations,
+	}
+	if e.Source != nil {
+		rec.Annotate(SourceKey, e.Source)
+	}
+	return rec
+}
+
+func (s *Spool) appendLocked(rec *Record) {
+	if s.closed {
+		s.dropped++
+		return
+	}
+	line := encodeSpoolEntry(rec)
+	if line == nil {
+		s.dropped++
+		return
+	}
+
+	n := len(s.segs)
+	if s.active == nil || s.segs[n-1].size+int64(len(line)) > s.cfg.SegmentSize {
+		if err := s.rotateLocked(); err != nil {
+			s.dropped++
+			return
+		}
+		n = len(s.segs)
+	}
+	if _, err := s.active.Write(line); err != nil {
+		s.dropped++
+		return
+	}
+	seg := s.segs[n-1]
+	seg.size += int64(len(line))
+	seg.records++
+	s.size += int64(len(line))
+
+	// evict the oldest segments if we're over budget, but never
+	// the one we're appending to
+	for s.size > s.cfg.MaxBytes && len(s.segs) > 1 {
+		s.evictLocked()
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Spool) rotateLocked() error {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+	seq := s.nextSeq
+	f, err := os.OpenFile(s.segPath(seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.active = f
+	s.segs = append(s.segs, &spoolSegment{seq: seq})
+	if len(s.segs) == 1 {
+		s.readSeq = seq
+		s.readOff = 0
+	}
+	return nil
+}
+
+func (s *Spool) evictLocked() {
+	seg := s.segs[0]
+	s.dropped += uint64(seg.records)
+	s.removeHeadLocked()
+}
+
+// removeHeadLocked discards the oldest segment, moving the read
+// cursor to the start of the next one
+func (s *Spool) removeHeadLocked() {
+	seg := s.segs[0]
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	os.Remove(s.segPath(seg.seq))
+	s.size -= seg.size
+	s.segs = s.segs[1:]
+	if len(s.segs) == 0 {
+		if s.active != nil {
+			s.active.Close()
+			s.active = nil
+		}
+		s.readSeq = 0
+		s.readOff = 0
+		os.Remove(filepath.Join(s.dir, cursorFile))
+		return
+	}
+	s.readSeq = s.segs[0].seq
+	s.readOff = 0
+	s.saveCursorLocked()
+}
+
+// peekLocked reads the record at the read cursor, returning io.EOF
+// at the end of the oldest segment
+func (s *Spool) peekLocked() (*spoolEntry, int64, error) {
+	if s.reader == nil {
+		f, err := os.Open(s.segPath(s.readSeq))
+		if err != nil {
+			return nil, 0, err
+		}
+		s.reader = f
+	}
+	if _, err := s.reader.Seek(s.readOff, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	line, err := bufio.NewReader(s.reader).ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		if len(s.segs) > 1 || s.active == nil {
+			// a partial line at the end of a segment nobody
+			// is appending to anymore is never going to be
+			// completed
+			return nil, int64(len(line)), errCorruptEntry
+		}
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var e spoolEntry
+	if err := json.Unmarshal(bytes.TrimSpace(line), &e); err != nil {
+		return nil, int64(len(line)), errCorruptEntry
+	}
+	return &e, int64(len(line)), nil
+}
+
+type spoolError string
+
+func (err spoolError) Error() string {
+	return string(err)
+}
+
+const errCorruptEntry = spoolError("corrupt spool entry")
+
+func (s *Spool) replay() {
+	defer s.wg.Done()
+	for {
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			return
+		}
+		if len(s.segs) == 0 {
+			s.lock.Unlock()
+			select {
+			case <-s.wake:
+			case <-s.done:
+				return
+			}
+			continue
+		}
+
+		e, n, err := s.peekLocked()
+		switch {
+		case err == io.EOF:
+			if len(s.segs) > 1 || s.readOff >= s.segs[0].size {
+				// we've drained this segment
+				s.removeHeadLocked()
+				s.lock.Unlock()
+				continue
+			}
+			// caught up with a segment that might still grow
+			s.lock.Unlock()
+			select {
+			case <-s.wake:
+			case <-s.done:
+				return
+			}
+			continue
+		case err == errCorruptEntry:
+			s.readOff += n
+			s.segs[0].records--
+			s.dropped++
+			s.saveCursorLocked()
+			s.lock.Unlock()
+			continue
+		case err != nil:
+			// can't read the segment; give up on it
+			s.evictLocked()
+			s.lock.Unlock()
+			continue
+		}
+		seq := s.readSeq
+		s.lock.Unlock()
+
+		if err := s.target.TryWrite(e.record(), 1); err != nil {
+			select {
+			case <-time.After(s.cfg.RetryInterval):
+			case <-s.done:
+				return
+			}
+			continue
+		}
+
+		s.lock.Lock()
+		// the segment may have been evicted while we were busy
+		if seq == s.readSeq && len(s.segs) > 0 {
+			s.readOff += n
+			s.segs[0].records--
+			s.saveCursorLocked()
+		}
+		s.lock.Unlock()
+	}
+}
+
+// Stats reports the size of the backlog
+func (s *Spool) Stats() SpoolStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st := SpoolStats{
+		Segments: len(s.segs),
+		Bytes:    s.size,
+		Dropped:  s.dropped,
+	}
+	for _, seg := range s.segs {
+		st.Pending += seg.records
+	}
+	return st
+}
+
+// Close stops replaying; anything not yet delivered stays on disk
+// for the next time a spool is opened on the same directory.
+func (s *Spool) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.lock.Unlock()
+
+	s.wg.Wait()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spoolTarget accepts records while it has budget (a negative
+// budget is unlimited) and fails otherwise
+type spoolTarget struct {
+	lock   sync.Mutex
+	budget int
+	got    []string
+}
+
+func (t *spoolTarget) Write(rec *Record, skip int) {
+	t.TryWrite(rec, skip+1)
+}
+
+func (t *spoolTarget) TryWrite(rec *Record, skip int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.budget == 0 {
+		return errors.New("down")
+	}
+	if t.budget > 0 {
+		t.budget--
+	}
+	t.got = append(t.got, fmt.Sprintf(rec.Format, rec.Args...))
+	return nil
+}
+
+func (t *spoolTarget) setBudget(n int) {
+	t.lock.Lock()
+	t.budget = n
+	t.lock.Unlock()
+}
+
+func (t *spoolTarget) received() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]string(nil), t.got...)
+}
+
+func (t *spoolTarget) waitFor(tb testing.TB, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := t.received(); len(got) >= n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := t.received()
+	tb.Fatalf("got %d records, wanted %d: %q", len(got), n, got)
+	return nil
+}
+
+var testSpoolConfig = SpoolConfig{
+	SegmentSize:   256,
+	RetryInterval: 5 * time.Millisecond,
+}
+
+func spoolRecord(i int) *Record {
+	return &Record{
+		ID:        uint64(i),
+		Module:    "spool",
+		Level:     INFO,
+		Timestamp: time.Now(),
+		Format:    "r%d",
+		Args:      []interface{}{i},
+	}
+}
+
+func TestSpoolReplayAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	target := &spoolTarget{}
+
+	s, err := NewSpool(dir, target, testSpoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Write(spoolRecord(i), 0)
+	}
+	if st := s.Stats(); st.Pending != 10 || st.Segments < 2 {
+		t.Fatalf("expected 10 records over several segments, got %+v", st)
+	}
+	s.Close()
+
+	// deliver some of the backlog, then stop again part way through
+	target.setBudget(4)
+	s, err = NewSpool(dir, target, testSpoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.waitFor(t, 4)
+	s.Close()
+	if st := s.Stats(); st.Pending != 6 {
+		t.Fatalf("expected 6 pending after partial delivery, got %+v", st)
+	}
+
+	// the rest goes out after another restart, without repeats
+	target.setBudget(-1)
+	s, err = NewSpool(dir, target, testSpoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got := target.waitFor(t, 10)
+	time.Sleep(20 * time.Millisecond)
+	got = target.received()
+	if len(got) != 10 {
+		t.Fatalf("expected 10 records, got %q", got)
+	}
+	for i, msg := range got {
+		if want := fmt.Sprintf("r%d", i); msg != want {
+			t.Fatalf("record %d is %q, wanted %q (all: %q)", i, msg, want, got)
+		}
+	}
+	if st := s.Stats(); st.Pending != 0 || st.Dropped != 0 {
+		t.Fatalf("expected an empty spool, got %+v", st)
+	}
+}
+
+func TestSpoolEvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	target := &spoolTarget{}
+	cfg := testSpoolConfig
+	cfg.MaxBytes = 1024
+
+	s, err := NewSpool(dir, target, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	const n = 100
+	for i := 0; i < n; i++ {
+		s.Write(spoolRecord(i), 0)
+	}
+	st := s.Stats()
+	if st.Dropped == 0 || st.Bytes > cfg.MaxBytes {
+		t.Fatalf("expected eviction to keep the spool within budget, got %+v", st)
+	}
+	if st.Pending+int(st.Dropped) != n {
+		t.Fatalf("expected pending and dropped to add up to %d, got %+v", n, st)
+	}
+
+	target.setBudget(-1)
+	got := target.waitFor(t, st.Pending)
+	if got[len(got)-1] != fmt.Sprintf("r%d", n-1) {
+		t.Fatalf("expected the newest record to survive, got %q", got)
+	}
+	if got[0] != fmt.Sprintf("r%d", st.Dropped) {
+		t.Fatalf("expected the oldest records to be evicted, got %q", got)
+	}
+}
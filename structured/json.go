@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"runtime"
 	"time"
 
 	"github.com/dkolbly/logging"
@@ -37,7 +36,7 @@ func Format(r *logging.Record, skip int) []byte {
 	lr.Module = r.Module
 	lr.Level = r.Level.String()
 
-	_, file, line, ok := runtime.Caller(skip)
+	file, line, ok := r.Caller(skip)
 	if ok {
 		lr.File = path.Base(file)
 		lr.Line = line
@@ -92,6 +91,9 @@ func AutoWriter() *logging.LevelFilter {
 	}
 	lf := logging.MustFilter(writer)
 	lf.SetLevel(logging.INFO, "*")
+	if err := lf.ApplyEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "structured: %s\n", err)
+	}
 	return lf
 }
 
@@ -0,0 +1,57 @@
+package structured
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkolbly/logging"
+)
+
+// A LogfmtFormatter formats records as a line of key=value pairs:
+// the timestamp, level, module, file, message and then any
+// annotations in order by key.  Values are quoted if need be.
+type LogfmtFormatter struct {
+}
+
+func (lf *LogfmtFormatter) Format(r *logging.Record, nocolor bool, skip int) []byte {
+	var buf bytes.Buffer
+
+	logfmtPair(&buf, "ts", r.Timestamp.UTC().Format(time.RFC3339Nano))
+	logfmtPair(&buf, "level", strings.ToLower(r.Level.String()))
+	logfmtPair(&buf, "module", r.Module)
+	if file, line, ok := r.Caller(skip); ok {
+		logfmtPair(&buf, "file", fmt.Sprintf("%s:%d", path.Base(file), line))
+	}
+	logfmtPair(&buf, "msg", fmt.Sprintf(r.Format, r.Args...))
+
+	keys := make([]string, 0, len(r.Annotations))
+	for k := range r.Annotations {
+		if k != logging.SourceKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		logfmtPair(&buf, k, fmt.Sprint(r.Annotations[k]))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func logfmtPair(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n\\") {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
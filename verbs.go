@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A VerbFunc writes its part of a formatted record to the output
+// context
+type VerbFunc func(*OutputContext)
+
+// A VerbMaker compiles the options of a pattern verb (the part after
+// the colon in %{verb:options}, which is empty if there is none) into
+// the function that renders it.
+type VerbMaker func(options string) (VerbFunc, error)
+
+var verbLock sync.RWMutex
+
+// the names that compilePattern handles itself
+var reservedVerbs = map[string]bool{
+	"if":     true,
+	"else":   true,
+	"end":    true,
+	"annots": true,
+}
+
+var verbNameRe = regexp.MustCompile(`^[a-z][a-z/]*$`)
+
+// RegisterVerb adds a verb to the pattern language, making %{name} (or
+// %{name:options}) available in patterns compiled afterwards.  A
+// colorOnly verb is one whose output only makes sense on a terminal,
+// and is left out entirely when the output is not in color.  It is an
+// error to register a name that is already taken.
+//
+//	logging.RegisterVerb("tenant", func(options string) (logging.VerbFunc, error) {
+//		return func(ctx *logging.OutputContext) {
+//			ctx.WriteString(tenantOf(ctx.Record()))
+//		}, nil
+//	}, false)
+func RegisterVerb(name string, maker VerbMaker, colorOnly bool) error {
+	if !verbNameRe.MatchString(name) || reservedVerbs[name] ||
+		strings.HasPrefix(name, "annot/") ||
+		strings.HasPrefix(name, "since/") {
+		return fmt.Errorf("logger: invalid verb name %q", name)
+	}
+	if maker == nil {
+		return fmt.Errorf("logger: no maker for verb %q", name)
+	}
+
+	verbLock.Lock()
+	defer verbLock.Unlock()
+	if _, ok := verbTable[name]; ok {
+		return fmt.Errorf("logger: verb %q is already registered", name)
+	}
+	verbTable[name] = func(options string) (fragmentFormatter, error) {
+		frag, err := maker(options)
+		return fragmentFormatter(frag), err
+	}
+	if colorOnly {
+		colorTable[name] = true
+	}
+	return nil
+}
+
+// MustRegisterVerb is like RegisterVerb but panics on error, for use
+// in package initialization
+func MustRegisterVerb(name string, maker VerbMaker, colorOnly bool) {
+	if err := RegisterVerb(name, maker, colorOnly); err != nil {
+		panic(err)
+	}
+}
+
+func lookupVerb(name string) (maker fragMaker, colorOnly bool, ok bool) {
+	verbLock.RLock()
+	defer verbLock.RUnlock()
+	maker, ok = verbTable[name]
+	return maker, colorTable[name], ok
+}
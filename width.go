@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges are the (main) ranges of East Asian wide and fullwidth
+// characters, which take up two columns on a terminal
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x231a, 0x231b},   // watch, hourglass
+	{0x2e80, 0x303e},   // CJK radicals .. CJK symbols and punctuation
+	{0x3041, 0x33ff},   // Hiragana .. CJK compatibility
+	{0x3400, 0x4dbf},   // CJK unified ideographs extension A
+	{0x4e00, 0x9fff},   // CJK unified ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},   // CJK compatibility forms
+	{0xff00, 0xff60},   // fullwidth forms
+	{0xffe0, 0xffe6},   // fullwidth signs
+	{0x1f300, 0x1f64f}, // pictographs, emoticons
+	{0x1f900, 0x1f9ff}, // supplemental pictographs
+	{0x20000, 0x3fffd}, // CJK extensions
+}
+
+// runeWidth returns the number of columns a rune takes up on a terminal
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		// the common case, no combining marks or wide characters
+		if r < ' ' || r == 0x7f {
+			return 0
+		}
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wr := range wideRanges {
+		if r < wr[0] {
+			break
+		}
+		if r <= wr[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of columns the text takes up
+func displayWidth(data []byte) int {
+	n := 0
+	for len(data) > 0 {
+		if data[0] < utf8.RuneSelf {
+			if data[0] >= ' ' && data[0] != 0x7f {
+				n++
+			}
+			data = data[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(data)
+		n += runeWidth(r)
+		data = data[size:]
+	}
+	return n
+}
+
+func stringWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
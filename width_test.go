@@ -0,0 +1,33 @@
+package logging
+
+import "testing"
+
+func TestDisplayWidth(t *testing.T) {
+	for s, want := range map[string]int{
+		"":            0,
+		"abc":         3,
+		"héllo":       5,
+		"e\u0301":     1, // combining accent
+		"世界":          4,
+		"한국":          4,
+		"ｆｕｌｌ":        8,
+		"😀":           2,
+		"\x1b[0m":     3, // the escape itself takes no room
+		"tab\tstop":   7,
+		"zero\u200bw": 5, // zero width space
+	} {
+		if got := displayWidth([]byte(s)); got != want {
+			t.Errorf("displayWidth(%q) = %d, wanted %d", s, got, want)
+		}
+		if got := stringWidth(s); got != want {
+			t.Errorf("stringWidth(%q) = %d, wanted %d", s, got, want)
+		}
+	}
+}
+
+func TestLeftMarginAfterWideCharacters(t *testing.T) {
+	got := formatPlain(t, "世界 %{leftmargin}%{message}", &Record{Format: "a\nb"})
+	if want := "世界 a\n     b"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a FallibleWriter that keeps the messages written to it,
+// and can be made to fail or to block
+type recorder struct {
+	lock  sync.Mutex
+	fail  error
+	block chan struct{} // if not nil, writes wait for it to be closed
+	recs  []*Record
+}
+
+func (r *recorder) Write(rec *Record, skip int) {
+	r.TryWrite(rec, skip+1)
+}
+
+func (r *recorder) TryWrite(rec *Record, skip int) error {
+	r.lock.Lock()
+	block := r.block
+	r.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.fail != nil {
+		return r.fail
+	}
+	r.recs = append(r.recs, rec)
+	return nil
+}
+
+func (r *recorder) setFail(err error) {
+	r.lock.Lock()
+	r.fail = err
+	r.lock.Unlock()
+}
+
+func (r *recorder) records() []*Record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*Record(nil), r.recs...)
+}
+
+func (r *recorder) messages() []string {
+	var lst []string
+	for _, rec := range r.records() {
+		lst = append(lst, fmt.Sprintf(rec.Format, rec.Args...))
+	}
+	return lst
+}
+
+func testRecord(module string, level Level, format string, args ...interface{}) *Record {
+	return &Record{
+		Module:    module,
+		Level:     level,
+		Timestamp: time.Now(),
+		Format:    format,
+		Args:      args,
+	}
+}
+
+// eventually waits (for a while) for cond to hold
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}